@@ -0,0 +1,33 @@
+package formy_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bigelle/formy"
+)
+
+func ExampleBuildBytes() {
+	body, contentType, err := formy.BuildBytes(func(w *formy.Writer) {
+		w.WriteString("name", "alice").
+			WriteFile("avatar", "avatar.txt", strings.NewReader("hello"))
+	}, formy.WithBoundary("boundary"))
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(contentType)
+	fmt.Print(strings.ReplaceAll(string(body), "\r\n", "\n"))
+	// Output:
+	// multipart/form-data; boundary=boundary
+	// --boundary
+	// Content-Disposition: form-data; name="name"
+	//
+	// alice
+	// --boundary
+	// Content-Disposition: form-data; name="avatar"; filename="avatar.txt"
+	// Content-Type: text/plain; charset=utf-8
+	//
+	// hello
+	// --boundary--
+}
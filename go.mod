@@ -2,11 +2,13 @@ module github.com/bigelle/formy
 
 go 1.24.4
 
-require github.com/stretchr/testify v1.10.0
+require (
+	github.com/gabriel-vasile/mimetype v1.4.9
+	github.com/stretchr/testify v1.10.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/gabriel-vasile/mimetype v1.4.9 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/net v0.39.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -0,0 +1,145 @@
+package formy
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"time"
+)
+
+// GroupWriter writes fields into the parent [Writer] only if the condition of the group was true.
+// It shares the errors with the parent, so they are checked on the parent as usual.
+// It's created by [Writer.Group] and ended by [GroupWriter.End]
+type GroupWriter struct {
+	w  *Writer
+	ok bool
+}
+
+// Group returns a builder gating all of its writes by cond, which is called once, right away.
+// It saves repeating the same condition in many Cond calls:
+//
+//	w.Group(isAdmin).
+//		WriteString("role", "admin").
+//		WriteInt("level", 3).
+//		End().
+//		WriteString("name", name)
+func (w *Writer) Group(cond Condition) *GroupWriter {
+	return &GroupWriter{w: w, ok: cond()}
+}
+
+// End ends the group, returning the parent writer
+func (g *GroupWriter) End() *Writer {
+	return g.w
+}
+
+// WriteString is [Writer.WriteString] gated by the condition of the group
+func (g *GroupWriter) WriteString(fieldname, str string) *GroupWriter {
+	if g.ok {
+		g.w.WriteString(fieldname, str)
+	}
+	return g
+}
+
+// WriteStringer is [Writer.WriteStringer] gated by the condition of the group
+func (g *GroupWriter) WriteStringer(fieldname string, s fmt.Stringer) *GroupWriter {
+	if g.ok {
+		g.w.WriteStringer(fieldname, s)
+	}
+	return g
+}
+
+// WriteBytes is [Writer.WriteBytes] gated by the condition of the group
+func (g *GroupWriter) WriteBytes(fieldname string, b []byte) *GroupWriter {
+	if g.ok {
+		g.w.WriteBytes(fieldname, b)
+	}
+	return g
+}
+
+// WriteTextMarshaler is [Writer.WriteTextMarshaler] gated by the condition of the group
+func (g *GroupWriter) WriteTextMarshaler(fieldname string, m encoding.TextMarshaler) *GroupWriter {
+	if g.ok {
+		g.w.WriteTextMarshaler(fieldname, m)
+	}
+	return g
+}
+
+// WriteAnyTextField is [Writer.WriteAnyTextField] gated by the condition of the group
+func (g *GroupWriter) WriteAnyTextField(fieldname string, val any) *GroupWriter {
+	if g.ok {
+		g.w.WriteAnyTextField(fieldname, val)
+	}
+	return g
+}
+
+// WriteInt is [Writer.WriteInt] gated by the condition of the group
+func (g *GroupWriter) WriteInt(fieldname string, i int) *GroupWriter {
+	if g.ok {
+		g.w.WriteInt(fieldname, i)
+	}
+	return g
+}
+
+// WriteInt64 is [Writer.WriteInt64] gated by the condition of the group
+func (g *GroupWriter) WriteInt64(fieldname string, i int64) *GroupWriter {
+	if g.ok {
+		g.w.WriteInt64(fieldname, i)
+	}
+	return g
+}
+
+// WriteUint64 is [Writer.WriteUint64] gated by the condition of the group
+func (g *GroupWriter) WriteUint64(fieldname string, u uint64) *GroupWriter {
+	if g.ok {
+		g.w.WriteUint64(fieldname, u)
+	}
+	return g
+}
+
+// WriteBool is [Writer.WriteBool] gated by the condition of the group
+func (g *GroupWriter) WriteBool(fieldname string, b bool) *GroupWriter {
+	if g.ok {
+		g.w.WriteBool(fieldname, b)
+	}
+	return g
+}
+
+// WriteFloat64 is [Writer.WriteFloat64] gated by the condition of the group
+func (g *GroupWriter) WriteFloat64(fieldname string, f float64) *GroupWriter {
+	if g.ok {
+		g.w.WriteFloat64(fieldname, f)
+	}
+	return g
+}
+
+// WriteTime is [Writer.WriteTime] gated by the condition of the group
+func (g *GroupWriter) WriteTime(fieldname string, t time.Time, layout string) *GroupWriter {
+	if g.ok {
+		g.w.WriteTime(fieldname, t, layout)
+	}
+	return g
+}
+
+// WriteJSON is [Writer.WriteJSON] gated by the condition of the group
+func (g *GroupWriter) WriteJSON(fieldname string, v any) *GroupWriter {
+	if g.ok {
+		g.w.WriteJSON(fieldname, v)
+	}
+	return g
+}
+
+// WriteFile is [Writer.WriteFile] gated by the condition of the group
+func (g *GroupWriter) WriteFile(fieldname, filename string, file io.Reader) *GroupWriter {
+	if g.ok {
+		g.w.WriteFile(fieldname, filename, file)
+	}
+	return g
+}
+
+// WriteStruct is [Writer.WriteStruct] gated by the condition of the group
+func (g *GroupWriter) WriteStruct(v any) *GroupWriter {
+	if g.ok {
+		g.w.WriteStruct(v)
+	}
+	return g
+}
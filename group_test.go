@@ -0,0 +1,52 @@
+package formy_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bigelle/formy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_Group(t *testing.T) {
+	for _, isAdmin := range []bool{true, false} {
+		buf := bytes.NewBuffer(nil)
+		w := formy.NewWriter(buf)
+
+		var calls int
+		err := w.WriteString("name", "alice").
+			Group(func() bool {
+				calls++
+				return isAdmin
+			}).
+			WriteString("role", "admin").
+			WriteInt("level", 3).
+			WriteBool("super", true).
+			WriteJSON("perms", []string{"read", "write"}).
+			WriteFile("key", "key.txt", strings.NewReader("KEY")).
+			End().
+			WriteString("after", "text").
+			Close()
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, 1, calls)
+
+			var got []string
+			for _, p := range readParts(t, buf, w.Boundary()) {
+				got = append(got, p.name)
+			}
+			if isAdmin {
+				assert.Equal(t, []string{"name", "role", "level", "super", "perms", "key", "after"}, got)
+			} else {
+				assert.Equal(t, []string{"name", "after"}, got)
+			}
+		}
+	}
+
+	w := formy.NewWriter(io.Discard)
+	err := w.Group(func() bool { return true }).WriteString("", "text").End().Err()
+	assert.Error(t, err)
+	assert.Equal(t, err, w.Err())
+}
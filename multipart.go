@@ -1,32 +1,247 @@
 package formy
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
+	"maps"
+	"math"
+	"math/big"
+	"mime"
 	"mime/multipart"
+	"net/http"
 	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gabriel-vasile/mimetype"
 )
 
+// defaultContentType is used for file parts whose content type is unknown
+const defaultContentType = "application/octet-stream"
+
+// defaultDetectLimit is the default amount of bytes peeked from a file to detect its content type
+const defaultDetectLimit = 3072
+
+// copyChunkSize is the size of chunks used when a file is copied chunk by chunk
+const copyChunkSize = 32 * 1024
+
+// ErrFileTooLarge is returned when a file exceeds the size set with [Writer.SetMaxFileSize]
+var ErrFileTooLarge = errors.New("file is too large")
+
+// ErrBodyTooLarge is returned when the body exceeds the size set with [Writer.SetMaxTotalSize]
+var ErrBodyTooLarge = errors.New("body is too large")
+
 // Condition is a function that desides if the value should be writed or ignored
 type Condition func() bool
 
+// Detector is a function that returns the MIME type of a file
+// given its first bytes and its name. An empty result means the type is unknown
+type Detector func(peek []byte, filename string) string
+
 // Writer is a wrapper around [multipart.Writer].
+//
+// The body is complete only after [Writer.Close] writes the closing boundary,
+// so the destination must not be read or sent before that, or the server will reject it.
+// [Writer.CloseAndType] and [Writer.NewRequest] close the writer along the way,
+// and [Writer.SetStrict] turns such misuse into an error
 type Writer struct {
+	config
+
+	// in concurrency safe mode, mu is held while a part is written, serializing the parts,
+	// while smu guards the state read by the getters, so they can be called while a part is written
+	mu       sync.Mutex
+	smu      sync.Mutex
 	mw       *multipart.Writer
-	detectCt bool
+	cw       *countWriter
+	parts    int
+	seen     map[string]bool
 	firstErr error
+	errs     []error
+	closed   bool
+
+	// pending are the deferred writes made on close, see [Writer.WriteFileLazy]
+	pending []func()
+}
+
+// config holds the settings of a [Writer]
+type config struct {
+	detectCt    bool
+	collectAll  bool
+	safe        bool
+	must        bool
+	strictTime  bool
+	rejectNaN   bool
+	trimJSON    bool
+	maxFile     int64
+	maxParts    int
+	fallbackCt  string
+	extFallback bool
+	imageOnly   bool
+	decodeNames bool
+	nameFunc    func(string) string
+	partHook    func(name, filename, contentType string, size int64)
+	textCt      string
+	subtype     string
+	strictClose bool
+	detectLimit int
+	detector    Detector
+
+	strictNames bool
+	repeatable  map[string]bool
 }
 
 // NewWriter is a wrapper around [multipart.NewWriter] which is auto-detecting content type by default
 func NewWriter(w io.Writer) *Writer {
-	return &Writer{
-		mw:       multipart.NewWriter(w),
-		detectCt: true,
+	return NewWriterWith(w)
+}
+
+// NewWriterWith works like [NewWriter], but applies opts to the new writer
+func NewWriterWith(w io.Writer, opts ...Option) *Writer {
+	mw := new(Writer)
+	mw.reset(w)
+	for _, opt := range opts {
+		opt(mw)
+	}
+	return mw
+}
+
+// reset turns w into a new writer writing into out with the default settings,
+// reusing the memory it already holds
+func (w *Writer) reset(out io.Writer) {
+	cw := w.cw
+	if cw == nil {
+		cw = new(countWriter)
+	}
+	*cw = countWriter{w: out}
+
+	seen, errs := w.seen, w.errs
+	clear(seen)
+	clear(errs)
+
+	*w = Writer{
+		config: config{
+			detectCt:  true,
+			rejectNaN: true,
+		},
+		mw:   multipart.NewWriter(cw),
+		cw:   cw,
+		seen: seen,
+		errs: errs[:0],
+	}
+}
+
+// NewValidator returns a writer that discards everything written to it,
+// so it can be used to check that the fields would be written without errors
+// (names are valid, values are marshaled, files are opened and read, etc.).
+// [Writer.Err] and [Writer.Close] report the result
+func NewValidator(opts ...Option) *Writer {
+	return NewWriterWith(io.Discard, opts...)
+}
+
+// GenerateBoundary returns a random boundary of the given length made of the characters of alphabet,
+// which can be passed to [WithBoundary]. As RFC 2046 requires, length must be from 1 to 70,
+// and alphabet can only contain ASCII letters, digits and the characters '()+_,-./:=?.
+// If alphabet is empty, ASCII letters and digits are used
+func GenerateBoundary(length int, alphabet string) (string, error) {
+	if length < 1 || length > 70 {
+		return "", fmt.Errorf("invalid boundary length %d", length)
+	}
+	if alphabet == "" {
+		alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	}
+	for _, r := range alphabet {
+		if !isBoundaryChar(r) {
+			return "", fmt.Errorf("invalid boundary character %q", r)
+		}
+	}
+
+	b := make([]byte, length)
+	size := big.NewInt(int64(len(alphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// isBoundaryChar reports whether r is allowed in a boundary, except for the space
+func isBoundaryChar(r rune) bool {
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("'()+_,-./:=?", r)
+}
+
+// BuildBytes creates a writer with the given opts writing into memory, passes it to build
+// and closes it afterwards. It returns the resulting body along with its content type
+// (see [Writer.FormDataContentType]) or the error returned by [Writer.Close]
+func BuildBytes(build func(*Writer), opts ...Option) ([]byte, string, error) {
+	var buf bytes.Buffer
+	w := NewWriterWith(&buf, opts...)
+	build(w)
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
+
+// EstimateSize creates a writer with the given opts discarding everything written to it,
+// passes it to build and closes it afterwards. It returns the exact size of the body build would produce,
+// including the boundaries and headers, e.g. to set the "Content-Length" of a request before sending it.
+// The size doesn't depend on the boundary as long as its length is the same, so the body can then be
+// written for real by calling build again with a new writer. Note that files are read on both passes,
+// so build must be able to open or rewind them again
+func EstimateSize(build func(*Writer), opts ...Option) (int64, error) {
+	w := NewWriterWith(io.Discard, opts...)
+	build(w)
+	if err := w.Close(); err != nil {
+		return 0, err
 	}
+	return w.Written(), nil
+}
+
+// Clone returns a new writer bound to out with the same settings as w.
+// It copies only the configuration, not the already written bytes,
+// so it returns an error if any part was already written
+func (w *Writer) Clone(out io.Writer) (*Writer, error) {
+	if w.PartCount() > 0 {
+		return nil, errors.New("can't clone a writer after writing parts")
+	}
+	c := NewWriter(out)
+	c.config = w.config
+	c.repeatable = maps.Clone(w.repeatable)
+	c.cw.limit = w.cw.limit
+	return c, nil
 }
 
 // DetectContentType used to turn on/off content type detection
@@ -34,26 +249,268 @@ func (w *Writer) DetectContentType(b bool) {
 	w.detectCt = b
 }
 
+// CollectAllErrors used to turn on/off collecting of all errors.
+// By default, the writer stops at the first error and ignores every write after it.
+// When turned on, every failed write is recorded and the writer keeps going,
+// so [Writer.Errors] returns all of them and [Writer.Close] returns them joined with [errors.Join].
+// A failure of the destination itself still stops the writer, since the body can't be fixed after it
+func (w *Writer) CollectAllErrors(b bool) {
+	w.collectAll = b
+}
+
+// MustMode used to turn on/off must mode, in which any error panics immediately
+// with an error wrapping it and naming the field, instead of being recorded.
+// It's meant for initialization code, where any error is fatal anyway.
+// Don't use it while handling requests, unless every write is guarded with [recover]
+func (w *Writer) MustMode(b bool) {
+	w.must = b
+}
+
+// SetConcurrencySafe used to turn on/off concurrency safe mode, in which every part
+// is written under a lock, so the writer can be used from multiple goroutines at once.
+// Parts written concurrently don't interleave, but their order is not defined.
+// It's turned off by default to avoid the locking overhead.
+// It must be set before the writer is shared between goroutines.
+// The callbacks run while a part is written (like the progress ones) may call the getters,
+// such as [Writer.Written], [Writer.PartCount] or [Writer.Err], but must not write into w
+func (w *Writer) SetConcurrencySafe(b bool) {
+	w.safe = b
+}
+
+// RejectZeroTime used to turn on/off rejecting of the zero [time.Time]
+// by [Writer.WriteTime] and [Writer.WriteUnixTime]
+func (w *Writer) RejectZeroTime(b bool) {
+	w.strictTime = b
+}
+
+// TrimJSONNewline used to turn on/off trimming of the trailing newline
+// that [json.Encoder] appends to the values written by [Writer.WriteJSON] and friends.
+// It's off by default, so the parts end with "\n"
+func (w *Writer) TrimJSONNewline(b bool) {
+	w.trimJSON = b
+}
+
+// SetMaxFileSize sets the maximum size of a single file in bytes.
+// Writing a bigger file records an error wrapping [ErrFileTooLarge].
+// Zero means unlimited, which is the default
+func (w *Writer) SetMaxFileSize(n int64) {
+	w.maxFile = n
+}
+
+// SetMaxTotalSize sets the maximum size of the whole body in bytes, including boundaries and headers.
+// A write that would exceed it records an error wrapping [ErrBodyTooLarge] and stops the writer,
+// even if collecting of all errors is turned on. Zero means unlimited, which is the default
+func (w *Writer) SetMaxTotalSize(n int64) {
+	w.cw.limit = n
+}
+
+// SetMaxParts sets the maximum number of parts, e.g. when the fields come from untrusted input.
+// Writing more parts records an error naming the field that exceeded the limit.
+// Zero means unlimited, which is the default
+func (w *Writer) SetMaxParts(n int) {
+	w.maxParts = n
+}
+
+// Written returns the amount of bytes written so far across all parts
+func (w *Writer) Written() int64 {
+	return w.cw.written.Load()
+}
+
+// SetDetectLimit sets the amount of bytes peeked from a file to detect its content type.
+// Peeking more bytes lets the detection tell apart formats that look the same at the beginning,
+// while peeking less makes it faster and cheaper. Zero or negative n means the default of 3072 bytes
+func (w *Writer) SetDetectLimit(n int) {
+	w.detectLimit = n
+}
+
+// SetDetector sets the function used to detect the content type of files instead of the default
+// [mimetype]-based one. A nil d restores the default. The results that are not valid media types
+// are treated as unknown, so the fallback content type is used instead
+func (w *Writer) SetDetector(d Detector) {
+	w.detector = d
+}
+
+// SetFallbackContentType sets the content type of file parts used when the detection is turned off
+// or can't tell anything more specific than "application/octet-stream", which is the default.
+// If ct is not a valid media type, the error is recorded and the fallback is left unchanged
+func (w *Writer) SetFallbackContentType(ct string) {
+	if err := validateContentType(ct); err != nil {
+		w.setErr("", fmt.Errorf("invalid fallback content type %q: %w", ct, err))
+		return
+	}
+	w.fallbackCt = ct
+}
+
+// SetTextCharset makes the text fields have the "Content-Type" header
+// set to "text/plain" with the given charset, e.g. "utf-8", for servers requiring it.
+// By default, or if charset is empty, text fields have no content type.
+// If charset is not a valid token, the error is recorded and the setting is left unchanged
+func (w *Writer) SetTextCharset(charset string) {
+	if charset == "" {
+		w.textCt = ""
+		return
+	}
+	ct := "text/plain; charset=" + charset
+	if _, params, err := mime.ParseMediaType(ct); err != nil || params["charset"] != charset {
+		w.setErr("", fmt.Errorf("invalid text charset %q", charset))
+		return
+	}
+	w.textCt = ct
+}
+
+// SetFieldNameFunc sets the function applied to every field name before it's validated and written,
+// e.g. to convert the names to snake_case or add a common prefix. A nil f means the names are written as is.
+// It's not applied to the headers passed to [Writer.CreatePart]
+func (w *Writer) SetFieldNameFunc(f func(string) string) {
+	w.nameFunc = f
+}
+
+// SetSubtype sets the subtype of the multipart body returned by [Writer.FormDataContentType]
+// (and used by [Writer.NewRequest]), e.g. "related" for "multipart/related". It's "form-data" by default,
+// or if subtype is empty. The parts still have the "form-data" content disposition,
+// since [multipart.Writer] always emits it. If the subtype requires more parameters,
+// like "type" or "start" for "multipart/related", they should be appended to the content type
+// of the outer request by the caller. If subtype is not a valid token, the error is recorded
+// and the setting is left unchanged
+func (w *Writer) SetSubtype(subtype string) {
+	if subtype == "" || subtype == "form-data" {
+		w.subtype = ""
+		return
+	}
+	if mt, _, err := mime.ParseMediaType("multipart/" + subtype); err != nil || mt != "multipart/"+strings.ToLower(subtype) {
+		w.setErr("", fmt.Errorf("invalid multipart subtype %q", subtype))
+		return
+	}
+	w.subtype = subtype
+}
+
+// SetStrict used to turn on/off recording an error when [Writer.Boundary]
+// or [Writer.FormDataContentType] are called before [Writer.Close],
+// which usually means the body is about to be sent without the closing boundary
+func (w *Writer) SetStrict(b bool) {
+	w.strictClose = b
+}
+
+// SetExtensionFallback used to turn on/off guessing the content type of a file
+// from the extension of its name with [mime.TypeByExtension], when the detection
+// can't tell anything more specific than "application/octet-stream", e.g. for CSV files.
+// If the extension is unknown too, the fallback content type is used as usual
+func (w *Writer) SetExtensionFallback(b bool) {
+	w.extFallback = b
+}
+
+// SetImageOnly used to turn on/off recording an error in [Writer.WriteImage]
+// when the detected content type of the data is not an image
+func (w *Writer) SetImageOnly(b bool) {
+	w.imageOnly = b
+}
+
+// DecodeFilenames used to turn on/off decoding of percent-encoded file names with [url.PathUnescape]
+// before they're validated and written, e.g. for names taken from URLs, so "file%20name.txt"
+// is written as "file name.txt". The names that can't be decoded are written as is
+func (w *Writer) DecodeFilenames(b bool) {
+	w.decodeNames = b
+}
+
+// SetPartHook sets the function called after each part is successfully written,
+// with its field name, file name and content type (empty for text fields without them),
+// and the amount of bytes written into the part, e.g. for logging or metrics.
+// It's not called for the parts created with [Writer.CreatePart] and [Writer.CreateFormFile],
+// since their content is written by the caller. A nil fn disables the hook
+func (w *Writer) SetPartHook(fn func(name, filename, contentType string, size int64)) {
+	w.partHook = fn
+}
+
+// SetStrictFieldNames used to turn on/off strict mode, in which writing a field name
+// that was already written records an error, unless it was allowed with [Writer.AllowRepeated]
+func (w *Writer) SetStrictFieldNames(b bool) {
+	w.strictNames = b
+}
+
+// AllowRepeated allows writing the given field names multiple times in strict mode,
+// e.g. to use them with [WriteSlice] or [Writer.WriteValues]
+func (w *Writer) AllowRepeated(fieldnames ...string) {
+	if w.repeatable == nil {
+		w.repeatable = make(map[string]bool)
+	}
+	for _, name := range fieldnames {
+		w.repeatable[name] = true
+	}
+}
+
+// PartCount returns the amount of parts successfully created so far.
+// Skipped conditional writes are not counted
+func (w *Writer) PartCount() int {
+	defer w.stateLock()()
+	return w.parts
+}
+
+// SetRejectNonFinite used to turn on/off rejecting of NaN and infinite values by the float writers,
+// since most servers can't parse them. It's turned on by default.
+// When turned off, they are written as "NaN", "+Inf" and "-Inf"
+func (w *Writer) SetRejectNonFinite(b bool) {
+	w.rejectNaN = b
+}
+
 // Boundary is a wrapper around [multipart.Writer.Boundary]
-func (w Writer) Boundary() string {
+func (w *Writer) Boundary() string {
+	w.checkClosed("Boundary")
 	return w.mw.Boundary()
 }
 
-// FormDataContentType is a wrapper around [multipart.Writer.FormDataContentType]
-func (w Writer) FormDataContentType() string {
-	return w.mw.FormDataContentType()
+// SetBoundary is a wrapper around [multipart.Writer.SetBoundary], e.g. for a deterministic body to sign.
+// [Writer.FormDataContentType] quotes the boundary if it contains characters requiring it, like spaces.
+// If the boundary is invalid or any part was already written, the error is recorded
+func (w *Writer) SetBoundary(boundary string) {
+	w.setErr("", w.mw.SetBoundary(boundary))
+}
+
+// Unwrap returns the underlying [multipart.Writer], as an escape hatch for its features not wrapped by w.
+// It's meant for advanced use only: parts created directly are not validated, counted or limited
+// (except for [Writer.SetMaxTotalSize]), their errors are not recorded, strict field names are not tracked,
+// and they are not guarded in concurrency safe mode, so mixing them with the methods of w must be done with care
+func (w *Writer) Unwrap() *multipart.Writer {
+	return w.mw
 }
 
-// WriteString is a wrapper around [multipart.Writer.WriteField]
+// FormDataContentType is a wrapper around [multipart.Writer.FormDataContentType].
+// If the subtype was changed with [Writer.SetSubtype], it's used instead of "form-data"
+func (w *Writer) FormDataContentType() string {
+	w.checkClosed("FormDataContentType")
+	ct := w.mw.FormDataContentType()
+	if w.subtype != "" {
+		ct = "multipart/" + w.subtype + strings.TrimPrefix(ct, "multipart/form-data")
+	}
+	return ct
+}
+
+// WriteString creates a part with the given fieldname and writes str into it.
+// It is equivalent to [multipart.Writer.WriteField]
 func (w *Writer) WriteString(fieldname, str string) *Writer {
-	if w.firstErr == nil {
-		w.firstErr = w.mw.WriteField(fieldname, str)
+	if !w.failed() {
+		fieldname = w.fieldName(fieldname)
+		if err := validateFieldName(fieldname); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+
+		return w.writePart(fieldname, w.textHeader(fieldname), func(part io.Writer) error {
+			_, err := io.WriteString(part, str)
+			return err
+		})
 	}
 	return w
 }
 
-// WriteOptionalString is a wrapper around [multipart.Writer.WriteField]
-// that writes the string only if cond returns true
+// WriteEmpty creates a part with the given fieldname and no content,
+// for protocols distinguishing an empty field from an absent one.
+// It is equivalent to writing an empty string with [Writer.WriteString]
+func (w *Writer) WriteEmpty(fieldname string) *Writer {
+	return w.WriteString(fieldname, "")
+}
+
+// WriteStringCond creates a part with the given fieldname and writes str into it,
+// if cond returns true
 func (w *Writer) WriteStringCond(fieldname string, str string, cond Condition) *Writer {
 	if cond() {
 		return w.WriteString(fieldname, str)
@@ -61,257 +518,2077 @@ func (w *Writer) WriteStringCond(fieldname string, str string, cond Condition) *
 	return w
 }
 
-// WriteAnyTextField is equivalent to creating a part and writing val using [fmt.Fprint]
-// with the part as writer and val as value
-func (w *Writer) WriteAnyTextField(fieldname string, val any) *Writer {
-	if w.firstErr == nil {
-		if fieldname == "" {
-			w.firstErr = fmt.Errorf("empty field name")
-			return w
-		}
-		if val == nil {
-			w.firstErr = fmt.Errorf("empty field value")
-			return w
-		}
+// WriteStringWhen creates a part with the given fieldname and writes str into it, if ok is true.
+// Unlike [Writer.WriteStringCond], it takes an already computed condition
+func (w *Writer) WriteStringWhen(fieldname, str string, ok bool) *Writer {
+	if ok {
+		return w.WriteString(fieldname, str)
+	}
+	return w
+}
 
-		part, err := w.mw.CreatePart(textFieldHeader(fieldname))
-		if err != nil {
-			w.firstErr = err
-			return w
-		}
-		if _, err = fmt.Fprint(part, val); err != nil {
-			w.firstErr = err
-			return w
-		}
+// WriteStringIfNotEmpty creates a part with the given fieldname and writes str,
+// if str is not empty
+func (w *Writer) WriteStringIfNotEmpty(fieldname, str string) *Writer {
+	if str != "" {
+		return w.WriteString(fieldname, str)
 	}
 	return w
 }
 
-// WriteAnyTextField is equivalent to creating a part and writing val using [fmt.Fprint]
-// with the part as writer and val as value, if cond return true
-func (w *Writer) WriteAnyTextFieldCond(fieldname string, val any, cond Condition) *Writer {
-	if w.firstErr == nil && cond() {
-		if fieldname == "" {
-			w.firstErr = fmt.Errorf("empty field name")
+// WriteEnum creates a part with the given fieldname and writes value into it,
+// if it's one of allowed. Otherwise, an error listing the allowed values is recorded
+func (w *Writer) WriteEnum(fieldname, value string, allowed ...string) *Writer {
+	if !w.failed() {
+		fieldname = w.fieldName(fieldname)
+		if err := validateFieldName(fieldname); err != nil {
+			w.setErr(fieldname, err)
 			return w
 		}
-		if !cond() {
+		if !slices.Contains(allowed, value) {
+			w.setErr(fieldname, fmt.Errorf("invalid value %q for field %s, must be one of: %s", value, fieldname, strings.Join(allowed, ", ")))
 			return w
 		}
 
-		part, err := w.mw.CreatePart(textFieldHeader(fieldname))
-		if err != nil {
-			w.firstErr = err
-			return w
-		}
-		if _, err = fmt.Fprint(part, val); err != nil {
-			w.firstErr = err
-			return w
-		}
+		return w.writePart(fieldname, w.textHeader(fieldname), func(part io.Writer) error {
+			_, err := io.WriteString(part, value)
+			return err
+		})
 	}
 	return w
 }
 
-// WriteInt creates a part with the given fieldname and writes i as is.
-// It is a wrapper around [Writer.WriteAnyTextField]
-func (w *Writer) WriteInt(fieldname string, i int) *Writer {
-	return w.WriteAnyTextField(fieldname, i)
-}
-
-// WriteIntCond creates a part with the given fieldname and writes i if cond returns true.
-// It is a wrapper around [Writer.WriteAnyTextField]
-func (w *Writer) WriteIntCond(fieldname string, i int, cond Condition) *Writer {
+// WriteEnumCond creates a part with the given fieldname and writes value if cond returns true.
+// It is a wrapper around [Writer.WriteEnum]
+func (w *Writer) WriteEnumCond(fieldname, value string, cond Condition, allowed ...string) *Writer {
 	if cond() {
-		return w.WriteAnyTextField(fieldname, i)
+		return w.WriteEnum(fieldname, value, allowed...)
 	}
 	return w
 }
 
-// WriteBool creates a part with the given fieldname and writes b as is.
-// It is a wrapper around [Writer.WriteAnyTextField]
-func (w *Writer) WriteBool(fieldname string, b bool) *Writer {
-	return w.WriteAnyTextField(fieldname, b)
-}
-
-// WriteBoolCond creates a part with the given fieldname and writes b if cond returns true.
-// It is a wrapper around [Writer.WriteAnyTextField]
-func (w *Writer) WriteBoolCond(fieldname string, b bool, cond Condition) *Writer {
-	if cond() {
-		return w.WriteAnyTextField(fieldname, b)
+// WriteRune creates a part with the given fieldname and writes the UTF-8 encoding of r into it.
+// R must be a valid Unicode code point
+func (w *Writer) WriteRune(fieldname string, r rune) *Writer {
+	if !w.failed() {
+		if !utf8.ValidRune(r) {
+			w.setErr(fieldname, fmt.Errorf("invalid rune %U for field %s", r, fieldname))
+			return w
+		}
+		return w.WriteBytes(fieldname, utf8.AppendRune(nil, r))
 	}
 	return w
 }
 
-// WriteFloat32 creates a part with the given fieldname and writes f as is.
-// It is a wrapper around [Writer.WriteAnyTextField]
-func (w *Writer) WriteFloat32(fieldname string, f float32) *Writer {
-	return w.WriteAnyTextField(fieldname, f)
+// WriteByteField creates a part with the given fieldname and writes b into it as is
+func (w *Writer) WriteByteField(fieldname string, b byte) *Writer {
+	return w.WriteBytes(fieldname, []byte{b})
 }
 
-// WriteFloat32Cond creates a part with the given fieldname and writes f if cond returns true.
-// It is a wrapper around [Writer.WriteAnyTextField]
-func (w *Writer) WriteFloat32Cond(fieldname string, f float32, cond Condition) *Writer {
-	if cond() {
-		return w.WriteAnyTextField(fieldname, f)
+// WriteStringer creates a part with the given fieldname and writes the result of s.String().
+// S can't be nil
+func (w *Writer) WriteStringer(fieldname string, s fmt.Stringer) *Writer {
+	if !w.failed() {
+		if isNil(s) {
+			w.setErr(fieldname, fmt.Errorf("nil fmt.Stringer for field %s", fieldname))
+			return w
+		}
+		return w.WriteString(fieldname, s.String())
 	}
 	return w
 }
 
-// WriteFloat64 creates a part with the given fieldname and writes f as is.
-// It is a wrapper around [Writer.WriteAnyTextField]
-func (w *Writer) WriteFloat64(fieldname string, f float64) *Writer {
-	return w.WriteAnyTextField(fieldname, f)
-}
-
-// WriteFloat64 creates a part with the given fieldname and writes f if cond returns true.
-// It is a wrapper around [Writer.WriteAnyTextField]
-func (w *Writer) WriteFloat64Cond(fieldname string, f float64, cond Condition) *Writer {
+// WriteStringerCond creates a part with the given fieldname and writes the result of s.String(),
+// if cond returns true
+func (w *Writer) WriteStringerCond(fieldname string, s fmt.Stringer, cond Condition) *Writer {
 	if cond() {
-		return w.WriteAnyTextField(fieldname, f)
+		return w.WriteStringer(fieldname, s)
 	}
 	return w
 }
 
-// WriteJSON creates a part with the given fieldname and writes v as JSON encoded value.
-// V can't be nil
-func (w *Writer) WriteJSON(fieldname string, v any) *Writer {
-	if w.firstErr == nil {
-		if fieldname == "" {
-			w.firstErr = fmt.Errorf("empty field name")
-			return w
-		}
-		if v == nil {
-			w.firstErr = fmt.Errorf("empty field value")
+// WriteBytes creates a part with the given fieldname and writes b into it as is,
+// without converting it to a string first
+func (w *Writer) WriteBytes(fieldname string, b []byte) *Writer {
+	if !w.failed() {
+		fieldname = w.fieldName(fieldname)
+		if err := validateFieldName(fieldname); err != nil {
+			w.setErr(fieldname, err)
 			return w
 		}
 
-		part, err := w.mw.CreatePart(textFieldHeader(fieldname))
-		if err != nil {
-			w.firstErr = err
-			return w
-		}
+		return w.writePart(fieldname, w.textHeader(fieldname), func(part io.Writer) error {
+			_, err := part.Write(b)
+			return err
+		})
+	}
+	return w
+}
 
-		enc := json.NewEncoder(part)
-		enc.SetEscapeHTML(false)
-		if err := enc.Encode(v); err != nil {
-			w.firstErr = err
-			return w
-		}
+// WriteBytesCond creates a part with the given fieldname and writes b into it as is,
+// if cond returns true
+func (w *Writer) WriteBytesCond(fieldname string, b []byte, cond Condition) *Writer {
+	if cond() {
+		return w.WriteBytes(fieldname, b)
 	}
 	return w
 }
 
-// WriteJSON creates a part with the given fieldname,
-// and writes v as JSON encoded value if cond returns true
-func (w *Writer) WriteJSONCond(fieldname string, v any, cond Condition) *Writer {
-	if w.firstErr == nil {
-		if fieldname == "" {
-			w.firstErr = fmt.Errorf("empty field name")
-			return w
-		}
-		if !cond() {
+// WriteBytesIfNotEmpty creates a part with the given fieldname and writes b into it as is,
+// if b is not empty
+func (w *Writer) WriteBytesIfNotEmpty(fieldname string, b []byte) *Writer {
+	if len(b) != 0 {
+		return w.WriteBytes(fieldname, b)
+	}
+	return w
+}
+
+// WriteTextMarshaler creates a part with the given fieldname and writes the result of m.MarshalText().
+// M can't be nil
+func (w *Writer) WriteTextMarshaler(fieldname string, m encoding.TextMarshaler) *Writer {
+	if !w.failed() {
+		if isNil(m) {
+			w.setErr(fieldname, fmt.Errorf("nil encoding.TextMarshaler for field %s", fieldname))
 			return w
 		}
-
-		part, err := w.mw.CreatePart(textFieldHeader(fieldname))
+		b, err := m.MarshalText()
 		if err != nil {
-			w.firstErr = err
+			w.setErr(fieldname, err)
 			return w
 		}
+		return w.WriteBytes(fieldname, b)
+	}
+	return w
+}
 
-		enc := json.NewEncoder(part)
-		enc.SetEscapeHTML(false)
-		if err := enc.Encode(v); err != nil {
-			w.firstErr = err
-			return w
-		}
+// WriteTextMarshalerCond creates a part with the given fieldname and writes the result of m.MarshalText(),
+// if cond returns true
+func (w *Writer) WriteTextMarshalerCond(fieldname string, m encoding.TextMarshaler, cond Condition) *Writer {
+	if cond() {
+		return w.WriteTextMarshaler(fieldname, m)
 	}
 	return w
 }
 
-// WriteFile creates a part with the given fieldname and filename and writes the file into the part.
-// If w.detectCt is true, it will read the first 3072 bytes
-// and automatically set the "Content-Type" header to the most suitable MIME type.
-// Otherwise, or if the detection failed, "application/octet-stream" will be used instead
-func (w *Writer) WriteFile(fieldname, filename string, file io.Reader) *Writer {
-	if w.firstErr == nil {
-		if fieldname == "" {
-			w.firstErr = fmt.Errorf("empty field name")
+// WriteAnyTextField is equivalent to creating a part and writing val using [fmt.Fprint]
+// with the part as writer and val as value. As an exception, []byte and [json.RawMessage]
+// are written as is, like with [Writer.WriteBytes], rather than formatted as a slice of numbers.
+// Float NaN and infinities are rejected, unless turned off with [Writer.SetRejectNonFinite]
+func (w *Writer) WriteAnyTextField(fieldname string, val any) *Writer {
+	if !w.failed() {
+		fieldname = w.fieldName(fieldname)
+		if err := validateFieldName(fieldname); err != nil {
+			w.setErr(fieldname, err)
 			return w
 		}
-		if filename == "" {
-			w.firstErr = fmt.Errorf("empty file name")
+		if val == nil {
+			w.setErr(fieldname, fmt.Errorf("empty field value"))
 			return w
 		}
-		if file == nil {
-			w.firstErr = fmt.Errorf("empty file reader")
-			return w
+		switch v := val.(type) {
+		case float32:
+			if !w.finite(fieldname, float64(v)) {
+				return w
+			}
+		case float64:
+			if !w.finite(fieldname, v) {
+				return w
+			}
 		}
 
-		var (
-			err error
-			buf []byte
-		)
+		return w.writePart(fieldname, w.textHeader(fieldname), func(part io.Writer) error {
+			var err error
+			switch v := val.(type) {
+			case []byte:
+				_, err = part.Write(v)
+			case json.RawMessage:
+				_, err = part.Write(v)
+			default:
+				_, err = fmt.Fprint(part, val)
+			}
+			return err
+		})
+	}
+	return w
+}
 
-		// reading it to both detect content type and write it to the part
-		buf, err = io.ReadAll(file)
-		if err != nil {
-			w.firstErr = err
-			return w
-		}
+// WriteAnyTextFieldCond is equivalent to creating a part and writing val using [fmt.Fprint]
+// with the part as writer and val as value, if cond returns true. Cond is called exactly once.
+// It is a wrapper around [Writer.WriteAnyTextField]
+func (w *Writer) WriteAnyTextFieldCond(fieldname string, val any, cond Condition) *Writer {
+	if cond() {
+		return w.WriteAnyTextField(fieldname, val)
+	}
+	return w
+}
 
-		var h textproto.MIMEHeader
-		if w.detectCt {
-			h = fileFieldHeader(fieldname, filename, buf)
-		} else {
-			h = fileFieldHeader(fieldname, filename, nil)
-		}
-		part, err := w.mw.CreatePart(h)
-		if err != nil {
-			w.firstErr = err
-			return w
+// WriteSlice creates a part with the given fieldname for each element of vals,
+// preserving their order. Every element is written the same way as with [Writer.WriteAnyTextField]
+func WriteSlice[T any](w *Writer, fieldname string, vals []T) *Writer {
+	for _, v := range vals {
+		if w.failed() {
+			break
 		}
+		w.WriteAnyTextField(fieldname, v)
+	}
+	return w
+}
 
-		_, err = part.Write(buf)
-		if err != nil {
-			w.firstErr = err
-			return w
+// WriteIntSlice creates a part with the given fieldname for each element of vals,
+// preserving their order. Every element is written with [Writer.WriteInt]
+func (w *Writer) WriteIntSlice(fieldname string, vals []int) *Writer {
+	for _, v := range vals {
+		if w.failed() {
+			break
 		}
+		w.WriteInt(fieldname, v)
 	}
 	return w
 }
 
-// Close returns the first error occurred while writing any fields,
-// or the result of [multipart.Writer.Close]
-func (w *Writer) Close() error {
-	if w.firstErr != nil {
-		return w.firstErr
+// WriteIntSliceCond creates a part with the given fieldname for each element of vals if cond returns true.
+// It is a wrapper around [Writer.WriteIntSlice]
+func (w *Writer) WriteIntSliceCond(fieldname string, vals []int, cond Condition) *Writer {
+	if cond() {
+		return w.WriteIntSlice(fieldname, vals)
 	}
-	return w.mw.Close()
+	return w
 }
 
-func textFieldHeader(fieldname string) textproto.MIMEHeader {
-	h := textproto.MIMEHeader{
-		"Content-Disposition": {fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(fieldname))},
+// WriteFloat64Slice creates a part with the given fieldname for each element of vals,
+// preserving their order. Every element is written with [Writer.WriteFloat64]
+func (w *Writer) WriteFloat64Slice(fieldname string, vals []float64) *Writer {
+	for _, v := range vals {
+		if w.failed() {
+			break
+		}
+		w.WriteFloat64(fieldname, v)
 	}
-	return h
+	return w
 }
 
-func fileFieldHeader(fieldname, filename string, buf []byte) textproto.MIMEHeader {
-	h := textproto.MIMEHeader{
-		"Content-Disposition": {fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(fieldname), escapeQuotes(filename))},
+// WriteFloat64SliceCond creates a part with the given fieldname for each element of vals if cond returns true.
+// It is a wrapper around [Writer.WriteFloat64Slice]
+func (w *Writer) WriteFloat64SliceCond(fieldname string, vals []float64, cond Condition) *Writer {
+	if cond() {
+		return w.WriteFloat64Slice(fieldname, vals)
 	}
-	if buf != nil {
-		ct := mimetype.Detect(buf)
-		h.Set("Content-Type", ct.String())
-	} else {
-		h.Set("Content-Type", "application/octet-stream")
+	return w
+}
+
+// WritePtr creates a part with the given fieldname and writes the value p points to
+// the same way as [Writer.WriteAnyTextField], if p is not nil
+func WritePtr[T any](w *Writer, fieldname string, p *T) *Writer {
+	if p != nil {
+		return w.WriteAnyTextField(fieldname, *p)
 	}
-	return h
+	return w
+}
+
+// WriteWhen creates a part with the given fieldname and writes v
+// the same way as [Writer.WriteAnyTextField], if ok is true
+func WriteWhen[T any](w *Writer, fieldname string, v T, ok bool) *Writer {
+	if ok {
+		return w.WriteAnyTextField(fieldname, v)
+	}
+	return w
+}
+
+// WriteMap creates a part for each key of m with the value of that key.
+// The keys are written in sorted order, so the output is deterministic
+func (w *Writer) WriteMap(m map[string]string) *Writer {
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		if w.failed() {
+			break
+		}
+		w.WriteString(k, m[k])
+	}
+	return w
+}
+
+// WriteMapAny creates a part for each key of m, writing its value the same way as [Writer.WriteAnyTextField].
+// The keys are written in sorted order, so the output is deterministic
+func (w *Writer) WriteMapAny(m map[string]any) *Writer {
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		if w.failed() {
+			break
+		}
+		w.WriteAnyTextField(k, m[k])
+	}
+	return w
+}
+
+// WriteFields works like [Writer.WriteMap], but every error occurred while writing a field
+// is wrapped with the name of that field. With collecting of all errors turned on,
+// every field is written and [Writer.Errors] tells exactly which ones failed.
+// Otherwise, it stops at the first error like any other write
+func (w *Writer) WriteFields(fields map[string]string) *Writer {
+	for _, k := range slices.Sorted(maps.Keys(fields)) {
+		if w.failed() {
+			break
+		}
+		// the field is written like with WriteString, but the error is wrapped before it's recorded,
+		// so it can't be mixed up with the ones recorded concurrently
+		fieldname := w.fieldName(k)
+		err := validateFieldName(fieldname)
+		if err == nil {
+			err = w.tryWritePart(fieldname, w.textHeader(fieldname), func(part io.Writer) error {
+				_, err := io.WriteString(part, fields[k])
+				return err
+			})
+		}
+		if err != nil {
+			w.setErr(fieldname, fmt.Errorf("field %q: %w", k, err))
+		}
+	}
+	return w
+}
+
+// WriteValues creates a part for each value of each key of v, so a key with multiple values
+// produces multiple parts. The keys are written in sorted order, so the output is deterministic
+func (w *Writer) WriteValues(v url.Values) *Writer {
+	for _, k := range slices.Sorted(maps.Keys(v)) {
+		for _, val := range v[k] {
+			if w.failed() {
+				return w
+			}
+			w.WriteString(k, val)
+		}
+	}
+	return w
+}
+
+// WriteInt creates a part with the given fieldname and writes i as is.
+// It is a wrapper around [Writer.WriteAnyTextField]
+func (w *Writer) WriteInt(fieldname string, i int) *Writer {
+	return w.WriteAnyTextField(fieldname, i)
+}
+
+// WriteIntCond creates a part with the given fieldname and writes i if cond returns true.
+// It is a wrapper around [Writer.WriteAnyTextField]
+func (w *Writer) WriteIntCond(fieldname string, i int, cond Condition) *Writer {
+	if cond() {
+		return w.WriteAnyTextField(fieldname, i)
+	}
+	return w
+}
+
+// WriteIntIfNonZero creates a part with the given fieldname and writes i if it's not zero.
+// It is a wrapper around [Writer.WriteAnyTextField]
+func (w *Writer) WriteIntIfNonZero(fieldname string, i int) *Writer {
+	if i != 0 {
+		return w.WriteAnyTextField(fieldname, i)
+	}
+	return w
+}
+
+// WriteInt64 creates a part with the given fieldname and writes i as is.
+// It is a wrapper around [Writer.WriteAnyTextField]
+func (w *Writer) WriteInt64(fieldname string, i int64) *Writer {
+	return w.WriteAnyTextField(fieldname, i)
+}
+
+// WriteInt64Cond creates a part with the given fieldname and writes i if cond returns true.
+// It is a wrapper around [Writer.WriteAnyTextField]
+func (w *Writer) WriteInt64Cond(fieldname string, i int64, cond Condition) *Writer {
+	if cond() {
+		return w.WriteAnyTextField(fieldname, i)
+	}
+	return w
+}
+
+// WriteInt64IfNonZero creates a part with the given fieldname and writes i if it's not zero.
+// It is a wrapper around [Writer.WriteAnyTextField]
+func (w *Writer) WriteInt64IfNonZero(fieldname string, i int64) *Writer {
+	if i != 0 {
+		return w.WriteAnyTextField(fieldname, i)
+	}
+	return w
+}
+
+// WriteUint64 creates a part with the given fieldname and writes u as is.
+// It is a wrapper around [Writer.WriteAnyTextField]
+func (w *Writer) WriteUint64(fieldname string, u uint64) *Writer {
+	return w.WriteAnyTextField(fieldname, u)
+}
+
+// WriteUint64Cond creates a part with the given fieldname and writes u if cond returns true.
+// It is a wrapper around [Writer.WriteAnyTextField]
+func (w *Writer) WriteUint64Cond(fieldname string, u uint64, cond Condition) *Writer {
+	if cond() {
+		return w.WriteAnyTextField(fieldname, u)
+	}
+	return w
+}
+
+// WriteUint64IfNonZero creates a part with the given fieldname and writes u if it's not zero.
+// It is a wrapper around [Writer.WriteAnyTextField]
+func (w *Writer) WriteUint64IfNonZero(fieldname string, u uint64) *Writer {
+	if u != 0 {
+		return w.WriteAnyTextField(fieldname, u)
+	}
+	return w
+}
+
+// WriteBool creates a part with the given fieldname and writes b as is.
+// It is a wrapper around [Writer.WriteAnyTextField]
+func (w *Writer) WriteBool(fieldname string, b bool) *Writer {
+	return w.WriteAnyTextField(fieldname, b)
+}
+
+// WriteBoolCond creates a part with the given fieldname and writes b if cond returns true.
+// It is a wrapper around [Writer.WriteAnyTextField]
+func (w *Writer) WriteBoolCond(fieldname string, b bool, cond Condition) *Writer {
+	if cond() {
+		return w.WriteAnyTextField(fieldname, b)
+	}
+	return w
+}
+
+// WriteBoolIfTrue creates a part with the given fieldname and writes b if it's true.
+// It is a wrapper around [Writer.WriteAnyTextField]
+func (w *Writer) WriteBoolIfTrue(fieldname string, b bool) *Writer {
+	if b {
+		return w.WriteAnyTextField(fieldname, b)
+	}
+	return w
+}
+
+// WriteFloat32 creates a part with the given fieldname and writes f as is.
+// It is a wrapper around [Writer.WriteAnyTextField].
+// NaN and infinities are rejected, unless turned off with [Writer.SetRejectNonFinite]
+func (w *Writer) WriteFloat32(fieldname string, f float32) *Writer {
+	return w.WriteAnyTextField(fieldname, f)
+}
+
+// WriteFloat32Cond creates a part with the given fieldname and writes f if cond returns true.
+// It is a wrapper around [Writer.WriteFloat32]
+func (w *Writer) WriteFloat32Cond(fieldname string, f float32, cond Condition) *Writer {
+	if cond() {
+		return w.WriteFloat32(fieldname, f)
+	}
+	return w
+}
+
+// WriteFloat32IfNonZero creates a part with the given fieldname and writes f if it's not zero.
+// It is a wrapper around [Writer.WriteFloat32]
+func (w *Writer) WriteFloat32IfNonZero(fieldname string, f float32) *Writer {
+	if f != 0 {
+		return w.WriteFloat32(fieldname, f)
+	}
+	return w
+}
+
+// WriteFloat64 creates a part with the given fieldname and writes f as is.
+// It is a wrapper around [Writer.WriteAnyTextField].
+// NaN and infinities are rejected, unless turned off with [Writer.SetRejectNonFinite]
+func (w *Writer) WriteFloat64(fieldname string, f float64) *Writer {
+	return w.WriteAnyTextField(fieldname, f)
+}
+
+// WriteFloat64 creates a part with the given fieldname and writes f if cond returns true.
+// It is a wrapper around [Writer.WriteFloat64]
+func (w *Writer) WriteFloat64Cond(fieldname string, f float64, cond Condition) *Writer {
+	if cond() {
+		return w.WriteFloat64(fieldname, f)
+	}
+	return w
+}
+
+// WriteFloat64IfNonZero creates a part with the given fieldname and writes f if it's not zero.
+// It is a wrapper around [Writer.WriteFloat64]
+func (w *Writer) WriteFloat64IfNonZero(fieldname string, f float64) *Writer {
+	if f != 0 {
+		return w.WriteFloat64(fieldname, f)
+	}
+	return w
+}
+
+// WriteFloat creates a part with the given fieldname and writes f formatted
+// with [strconv.FormatFloat] using the given fmt and prec, e.g. 'f' and 2 for money.
+// NaN and infinities are rejected, unless turned off with [Writer.SetRejectNonFinite],
+// in which case they are written as "NaN", "+Inf" and "-Inf"
+func (w *Writer) WriteFloat(fieldname string, f float64, fmt byte, prec int) *Writer {
+	if !w.finite(fieldname, f) {
+		return w
+	}
+	return w.WriteString(fieldname, strconv.FormatFloat(f, fmt, prec, 64))
+}
+
+// WriteTime creates a part with the given fieldname and writes t formatted with layout.
+// If layout is empty, [time.RFC3339] is used
+func (w *Writer) WriteTime(fieldname string, t time.Time, layout string) *Writer {
+	if !w.failed() {
+		if w.strictTime && t.IsZero() {
+			w.setErr(fieldname, fmt.Errorf("zero time value for field %s", fieldname))
+			return w
+		}
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		return w.WriteString(fieldname, t.Format(layout))
+	}
+	return w
+}
+
+// WriteTimeCond creates a part with the given fieldname and writes t formatted with layout,
+// if cond returns true. If layout is empty, [time.RFC3339] is used
+func (w *Writer) WriteTimeCond(fieldname string, t time.Time, layout string, cond Condition) *Writer {
+	if cond() {
+		return w.WriteTime(fieldname, t, layout)
+	}
+	return w
+}
+
+// WriteUnixTime creates a part with the given fieldname and writes t as Unix time in seconds
+func (w *Writer) WriteUnixTime(fieldname string, t time.Time) *Writer {
+	if !w.failed() {
+		if w.strictTime && t.IsZero() {
+			w.setErr(fieldname, fmt.Errorf("zero time value for field %s", fieldname))
+			return w
+		}
+		return w.WriteString(fieldname, strconv.FormatInt(t.Unix(), 10))
+	}
+	return w
+}
+
+// WriteUnixTimeCond creates a part with the given fieldname and writes t as Unix time in seconds,
+// if cond returns true
+func (w *Writer) WriteUnixTimeCond(fieldname string, t time.Time, cond Condition) *Writer {
+	if cond() {
+		return w.WriteUnixTime(fieldname, t)
+	}
+	return w
+}
+
+// WriteDuration creates a part with the given fieldname and writes d formatted with [time.Duration.String],
+// e.g. "1h2m3.5s", which can be parsed back with [time.ParseDuration]
+func (w *Writer) WriteDuration(fieldname string, d time.Duration) *Writer {
+	return w.WriteString(fieldname, d.String())
+}
+
+// WriteDurationCond creates a part with the given fieldname and writes d if cond returns true.
+// It is a wrapper around [Writer.WriteDuration]
+func (w *Writer) WriteDurationCond(fieldname string, d time.Duration, cond Condition) *Writer {
+	if cond() {
+		return w.WriteDuration(fieldname, d)
+	}
+	return w
+}
+
+// WriteComplex128 creates a part with the given fieldname and writes c formatted
+// with [strconv.FormatComplex] using the 'g' format and the smallest precision, e.g. "(1.5+2i)",
+// which can be parsed back with [strconv.ParseComplex].
+// Like with [Writer.WriteFloat64], NaN and infinite parts are rejected by default
+func (w *Writer) WriteComplex128(fieldname string, c complex128) *Writer {
+	if !w.finite(fieldname, real(c)) || !w.finite(fieldname, imag(c)) {
+		return w
+	}
+	return w.WriteString(fieldname, strconv.FormatComplex(c, 'g', -1, 128))
+}
+
+// WriteComplex128Cond creates a part with the given fieldname and writes c if cond returns true.
+// It is a wrapper around [Writer.WriteComplex128]
+func (w *Writer) WriteComplex128Cond(fieldname string, c complex128, cond Condition) *Writer {
+	if cond() {
+		return w.WriteComplex128(fieldname, c)
+	}
+	return w
+}
+
+// WriteJSON creates a part with the given fieldname and writes v as JSON encoded value,
+// with "Content-Type" set to "application/json; charset=utf-8". V can't be nil
+func (w *Writer) WriteJSON(fieldname string, v any) *Writer {
+	if !w.failed() {
+		fieldname = w.fieldName(fieldname)
+		if err := validateFieldName(fieldname); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		if v == nil {
+			w.setErr(fieldname, fmt.Errorf("empty field value"))
+			return w
+		}
+
+		b, err := w.marshalJSON(v, "", "")
+		if err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+
+		return w.writePart(fieldname, jsonFieldHeader(fieldname), func(part io.Writer) error {
+			_, err := part.Write(b)
+			return err
+		})
+	}
+	return w
+}
+
+// WriteObject creates a part with the given fieldname and writes v, a structured object,
+// as compact JSON with "Content-Type" set to "application/json; charset=utf-8".
+// Currently, it's the same as [Writer.WriteJSON], but it states the intent
+// of sending a whole object in a single field among flat ones. V can't be nil
+func (w *Writer) WriteObject(fieldname string, v any) *Writer {
+	return w.WriteJSON(fieldname, v)
+}
+
+// WriteJSONIndent is like [Writer.WriteJSON], but writes v indented,
+// as with [json.MarshalIndent]. Each JSON element begins on a new line
+// starting with prefix followed by one or more copies of indent
+func (w *Writer) WriteJSONIndent(fieldname string, v any, prefix, indent string) *Writer {
+	if !w.failed() {
+		fieldname = w.fieldName(fieldname)
+		if err := validateFieldName(fieldname); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		if v == nil {
+			w.setErr(fieldname, fmt.Errorf("empty field value"))
+			return w
+		}
+
+		b, err := w.marshalJSON(v, prefix, indent)
+		if err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+
+		return w.writePart(fieldname, jsonFieldHeader(fieldname), func(part io.Writer) error {
+			_, err := part.Write(b)
+			return err
+		})
+	}
+	return w
+}
+
+// WriteJSONCond creates a part with the given fieldname,
+// and writes v as JSON encoded value if cond returns true.
+// If cond returns false, nothing is validated, like with [Writer.WriteStringCond].
+// It is a wrapper around [Writer.WriteJSON]
+func (w *Writer) WriteJSONCond(fieldname string, v any, cond Condition) *Writer {
+	if cond() {
+		return w.WriteJSON(fieldname, v)
+	}
+	return w
+}
+
+// WriteJSONArray creates a part with the given fieldname like [Writer.WriteJSON]
+// and writes a JSON array of n elements returned by item, encoding them one by one,
+// so the whole array is never materialized in memory. If any element can't be encoded,
+// the error is recorded and the rest of elements are not written
+func (w *Writer) WriteJSONArray(fieldname string, n int, item func(i int) any) *Writer {
+	if !w.failed() {
+		fieldname = w.fieldName(fieldname)
+		if err := validateFieldName(fieldname); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		if n < 0 {
+			w.setErr(fieldname, fmt.Errorf("negative array length %d for field %s", n, fieldname))
+			return w
+		}
+		if item == nil {
+			w.setErr(fieldname, fmt.Errorf("nil item function for field %s", fieldname))
+			return w
+		}
+
+		return w.writePart(fieldname, jsonFieldHeader(fieldname), func(part io.Writer) error {
+			// every element is encoded into buf first to drop the newline added by the encoder
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+
+			if _, err := io.WriteString(part, "["); err != nil {
+				return err
+			}
+			for i := range n {
+				buf.Reset()
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				if err := enc.Encode(item(i)); err != nil {
+					return fmt.Errorf("element %d of field %s: %w", i, fieldname, err)
+				}
+				if _, err := part.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))); err != nil {
+					return err
+				}
+			}
+
+			end := "]\n"
+			if w.trimJSON {
+				end = "]"
+			}
+			_, err := io.WriteString(part, end)
+			return err
+		})
+	}
+	return w
+}
+
+// marshalJSON returns v encoded as JSON with HTML escaping turned off,
+// and the trailing newline dropped if w.trimJSON is true.
+// It's marshaled before creating the part, so an invalid value doesn't leave a broken part behind
+func (w *Writer) marshalJSON(v any, prefix, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent(prefix, indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	b := buf.Bytes()
+	if w.trimJSON {
+		b = bytes.TrimSuffix(b, []byte("\n"))
+	}
+	return b, nil
+}
+
+// WriteJSONRaw creates a part with the given fieldname and writes raw into it as is.
+// Raw must be a valid JSON
+func (w *Writer) WriteJSONRaw(fieldname string, raw json.RawMessage) *Writer {
+	if !w.failed() {
+		fieldname = w.fieldName(fieldname)
+		if err := validateFieldName(fieldname); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		if !json.Valid(raw) {
+			w.setErr(fieldname, fmt.Errorf("invalid JSON for field %s", fieldname))
+			return w
+		}
+
+		return w.writePart(fieldname, jsonFieldHeader(fieldname), func(part io.Writer) error {
+			_, err := part.Write(raw)
+			return err
+		})
+	}
+	return w
+}
+
+// WriteTemplate creates a part with the given fieldname and executes tmpl with data straight into it.
+// Any execution error is recorded, but the part may be already partially written by then. Tmpl can't be nil
+func (w *Writer) WriteTemplate(fieldname string, tmpl *template.Template, data any) *Writer {
+	if !w.failed() {
+		fieldname = w.fieldName(fieldname)
+		if err := validateFieldName(fieldname); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		if tmpl == nil {
+			w.setErr(fieldname, fmt.Errorf("nil template for field %s", fieldname))
+			return w
+		}
+
+		return w.writePart(fieldname, w.textHeader(fieldname), func(part io.Writer) error {
+			return tmpl.Execute(part, data)
+		})
+	}
+	return w
+}
+
+// WriteTypedField creates a part with the given fieldname and writes value into it as is,
+// with "Content-Type" set to contentType, e.g. "application/yaml" for YAML.
+// Unlike files, the part has no file name. ContentType must be a valid media type
+func (w *Writer) WriteTypedField(fieldname, contentType, value string) *Writer {
+	if !w.failed() {
+		fieldname = w.fieldName(fieldname)
+		if err := validateFieldName(fieldname); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		if err := validateContentType(contentType); err != nil {
+			w.setErr(fieldname, fmt.Errorf("invalid content type %q: %w", contentType, err))
+			return w
+		}
+
+		h := textFieldHeader(fieldname)
+		h.Set("Content-Type", contentType)
+		return w.writePart(fieldname, h, func(part io.Writer) error {
+			_, err := io.WriteString(part, value)
+			return err
+		})
+	}
+	return w
+}
+
+// WriteXML creates a part with the given fieldname and writes v as XML encoded value,
+// with "Content-Type" set to "application/xml". V can't be nil
+func (w *Writer) WriteXML(fieldname string, v any) *Writer {
+	if !w.failed() {
+		fieldname = w.fieldName(fieldname)
+		if err := validateFieldName(fieldname); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		if v == nil {
+			w.setErr(fieldname, fmt.Errorf("empty field value"))
+			return w
+		}
+
+		b, err := xml.Marshal(v)
+		if err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+
+		return w.writePart(fieldname, xmlFieldHeader(fieldname), func(part io.Writer) error {
+			_, err := part.Write(b)
+			return err
+		})
+	}
+	return w
+}
+
+// WriteXMLCond creates a part with the given fieldname,
+// and writes v as XML encoded value if cond returns true
+func (w *Writer) WriteXMLCond(fieldname string, v any, cond Condition) *Writer {
+	if cond() {
+		return w.WriteXML(fieldname, v)
+	}
+	return w
+}
+
+// WriteFile creates a part with the given fieldname and filename and writes the file into the part.
+// If w.detectCt is true, it will peek at the first 3072 bytes (see [Writer.SetDetectLimit])
+// and automatically set the "Content-Type" header to the most suitable MIME type.
+// Otherwise, the fallback content type ("application/octet-stream" by default) will be used instead.
+// The file is streamed into the part with [io.Copy], so it's never read into memory as a whole,
+// and the sources implementing [io.WriterTo] (like [bytes.Reader] or [strings.Reader]) write themselves
+// into the part directly, without copying through an intermediate buffer. Note that there's no zero-copy
+// for an [os.File] (like sendfile), since the content has to pass through the multipart writer anyway
+func (w *Writer) WriteFile(fieldname, filename string, file io.Reader) *Writer {
+	return w.writeFile(fieldname, filename, file, fileOpts{})
+}
+
+// WriteNamedFile works like [Writer.WriteFile], using filename as both the field name and the file name
+func (w *Writer) WriteNamedFile(filename string, file io.Reader) *Writer {
+	return w.writeFile(filename, filename, file, fileOpts{})
+}
+
+// WriteFileNoName works like [Writer.WriteFile], but the part has no filename parameter
+// in the "Content-Disposition" header, for servers treating such parts as attachments.
+// The "Content-Type" header is still set to the detected content type
+func (w *Writer) WriteFileNoName(fieldname string, file io.Reader) *Writer {
+	return w.writeFile(fieldname, "", file, fileOpts{noFilename: true})
+}
+
+// WriteImage creates a file part with the given fieldname and writes data into it,
+// for images having no name of their own. The content type is always detected from data
+// like with [Writer.WriteReaderDetect], respecting [Writer.SetDetector] and [Writer.SetDetectLimit],
+// and the filename is generated from it, like "image.png" or "image.jpg",
+// or just "image" if the type has no known extension. See also [Writer.SetImageOnly]
+func (w *Writer) WriteImage(fieldname string, data []byte) *Writer {
+	if !w.failed() {
+		r, ct, err := w.detect(bytes.NewReader(data), "")
+		if err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		if ct == "" {
+			ct = defaultContentType
+		}
+		if w.imageOnly && !strings.HasPrefix(ct, "image/") {
+			w.setErr(fieldname, fmt.Errorf("expected an image, got %s", ct))
+			return w
+		}
+		return w.writeFile(fieldname, "image"+extensionByType(ct), r, fileOpts{contentType: ct})
+	}
+	return w
+}
+
+// WriteFileWithHeader works like [Writer.WriteFile], but merges extra into the generated part header.
+// On key collision, the values from extra take precedence over the generated ones,
+// including "Content-Disposition" and the detected "Content-Type"
+func (w *Writer) WriteFileWithHeader(fieldname, filename string, file io.Reader, extra textproto.MIMEHeader) *Writer {
+	return w.writeFile(fieldname, filename, file, fileOpts{header: extra})
+}
+
+// WriteFileWithContentID works like [Writer.WriteFile], but also sets the "Content-ID" header
+// to contentID enclosed in angle brackets, so the part can be referenced from other parts
+// of "multipart/related" payloads (see [Writer.SetSubtype]). The brackets are added only if missing
+func (w *Writer) WriteFileWithContentID(fieldname, filename, contentID string, file io.Reader) *Writer {
+	if !w.failed() {
+		id := strings.TrimSuffix(strings.TrimPrefix(contentID, "<"), ">")
+		if id == "" || hasControlChars(id) || strings.ContainsAny(id, "<> ") {
+			w.setErr(fieldname, fmt.Errorf("invalid content ID %q for field %s", contentID, fieldname))
+			return w
+		}
+		return w.writeFile(fieldname, filename, file, fileOpts{
+			header: textproto.MIMEHeader{"Content-Id": {"<" + id + ">"}},
+		})
+	}
+	return w
+}
+
+// WriteFileDisposition works like [Writer.WriteFile], but sets the type of the "Content-Disposition" header
+// to disposition, keeping the name and filename parameters, for servers inspecting it.
+// Disposition must be one of "form-data", "inline" or "attachment"
+func (w *Writer) WriteFileDisposition(fieldname, filename, disposition string, file io.Reader) *Writer {
+	if !w.failed() {
+		switch disposition = strings.ToLower(disposition); disposition {
+		case "form-data", "inline", "attachment":
+		default:
+			w.setErr(fieldname, fmt.Errorf("invalid disposition %q for field %s", disposition, fieldname))
+			return w
+		}
+		return w.writeFile(fieldname, filename, file, fileOpts{disposition: disposition})
+	}
+	return w
+}
+
+// WriteFileWithModTime works like [Writer.WriteFile], but also adds the "modification-date" parameter
+// to the "Content-Disposition" header, as defined by RFC 2183, e.g.
+// modification-date="Wed, 12 Feb 1997 16:29:51 -0500" (see [time.RFC1123Z])
+func (w *Writer) WriteFileWithModTime(fieldname, filename string, modTime time.Time, file io.Reader) *Writer {
+	if !w.failed() {
+		if modTime.IsZero() {
+			w.setErr(fieldname, fmt.Errorf("zero modification time for field %s", fieldname))
+			return w
+		}
+		return w.writeFile(fieldname, filename, file, fileOpts{
+			dispositionParams: fmt.Sprintf(`; modification-date="%s"`, modTime.Format(time.RFC1123Z)),
+		})
+	}
+	return w
+}
+
+// WriteFileAs works like [Writer.WriteFile], but skips the detection
+// and sets the "Content-Type" header to contentType, which must be a valid media type
+func (w *Writer) WriteFileAs(fieldname, filename, contentType string, file io.Reader) *Writer {
+	if !w.failed() {
+		if err := validateContentType(contentType); err != nil {
+			w.setErr(fieldname, fmt.Errorf("invalid content type %q: %w", contentType, err))
+			return w
+		}
+		return w.writeFile(fieldname, filename, file, fileOpts{contentType: contentType})
+	}
+	return w
+}
+
+// WriteFiles creates a file part with the given fieldname for each entry of files,
+// using the key as the file name and writing the value like [Writer.WriteFile].
+// The files are written in the order of their names, so the output is deterministic.
+// It stops at the first error, unless collecting of all errors is turned on
+func (w *Writer) WriteFiles(fieldname string, files map[string]io.Reader) *Writer {
+	for _, filename := range slices.Sorted(maps.Keys(files)) {
+		if w.failed() {
+			break
+		}
+		w.WriteFile(fieldname, filename, files[filename])
+	}
+	return w
+}
+
+// WriteFilePath opens the file at path and writes it like [Writer.WriteFile],
+// using the last element of path as the file name. The file is always closed before returning.
+// If it's a regular file, the "Content-Length" header is set to its size
+func (w *Writer) WriteFilePath(fieldname, path string) *Writer {
+	if !w.failed() {
+		f, err := os.Open(path)
+		if err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		defer f.Close()
+
+		return w.writeFile(fieldname, filepath.Base(path), f, fileOpts{header: statLength(f)})
+	}
+	return w
+}
+
+// WriteFileFS opens the file name from fsys and writes it like [Writer.WriteFile],
+// using the last element of name as the file name. The file is always closed before returning.
+// If it's a regular file, the "Content-Length" header is set to its size
+func (w *Writer) WriteFileFS(fsys fs.FS, fieldname, name string) *Writer {
+	if !w.failed() {
+		f, err := fsys.Open(name)
+		if err != nil {
+			w.setErr(fieldname, fmt.Errorf("can't open file %s for field %s: %w", name, fieldname, err))
+			return w
+		}
+		defer f.Close()
+
+		return w.writeFile(fieldname, path.Base(name), f, fileOpts{header: statLength(f)})
+	}
+	return w
+}
+
+// WriteFileLazy registers a file part with the given fieldname and filename,
+// but defers opening the file until the writer is flushed or closed, so registering many files
+// doesn't hold their descriptors open, and they are never opened if the form is abandoned.
+//
+// The names are validated right away, but open is only called by [Writer.Flush] or [Writer.Close],
+// which write the deferred parts in the order they were registered, after all the parts written before.
+// The file is written like with [Writer.WriteFile] and always closed afterwards.
+// Any error returned by open or occurred while writing the file is returned by [Writer.Flush] or [Writer.Close]
+func (w *Writer) WriteFileLazy(fieldname, filename string, open func() (io.ReadCloser, error)) *Writer {
+	if !w.failed() {
+		if err := validateFieldName(w.fieldName(fieldname)); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		if err := validateFileName(w.fileName(filename)); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		if open == nil {
+			w.setErr(fieldname, fmt.Errorf("nil open function for field %s", fieldname))
+			return w
+		}
+
+		unlock := w.stateLock()
+		w.pending = append(w.pending, func() {
+			f, err := open()
+			if err != nil {
+				w.setErr(fieldname, fmt.Errorf("can't open file %s for field %s: %w", filename, fieldname, err))
+				return
+			}
+			defer f.Close()
+
+			w.WriteFile(fieldname, filename, f)
+		})
+		unlock()
+	}
+	return w
+}
+
+// WriteFileClose works like [Writer.WriteFile], but closes rc afterwards.
+// Rc is always closed, even if the part wasn't written due to an error.
+// If both writing and closing fail, the recorded error joins both of them
+func (w *Writer) WriteFileClose(fieldname, filename string, rc io.ReadCloser) *Writer {
+	if rc == nil {
+		return w.writeFile(fieldname, filename, nil, fileOpts{})
+	}
+
+	var closed bool
+	defer func() {
+		if !closed {
+			if err := rc.Close(); err != nil {
+				w.setErr(fieldname, fmt.Errorf("can't close file for field %s: %w", fieldname, err))
+			}
+		}
+	}()
+
+	return w.writeFile(fieldname, filename, rc, fileOpts{close: func() error {
+		closed = true
+		return rc.Close()
+	}})
+}
+
+// WriteFileFromResponse streams the body of resp into a file part with the given fieldname and filename.
+// The content type is taken from the "Content-Type" header of resp, or detected like in [Writer.WriteFile]
+// if it's empty or invalid. The body is always closed before returning
+func (w *Writer) WriteFileFromResponse(fieldname, filename string, resp *http.Response) *Writer {
+	if resp == nil {
+		w.setErr(fieldname, fmt.Errorf("nil response for field %s", fieldname))
+		return w
+	}
+	if resp.Body == nil {
+		w.setErr(fieldname, fmt.Errorf("nil response body for field %s", fieldname))
+		return w
+	}
+	defer resp.Body.Close()
+
+	ct := resp.Header.Get("Content-Type")
+	if validateContentType(ct) != nil {
+		ct = ""
+	}
+	return w.writeFile(fieldname, filename, resp.Body, fileOpts{contentType: ct})
+}
+
+// WriteReader creates a part with the given fieldname, filename and contentType
+// and streams r into the part using [io.Copy], without reading it into memory first.
+// If contentType is empty, the fallback content type ("application/octet-stream" by default) is used,
+// since detecting the content type would require reading the beginning of r.
+// Otherwise, contentType must be a valid media type
+func (w *Writer) WriteReader(fieldname, filename string, r io.Reader, contentType string) *Writer {
+	if contentType == "" {
+		contentType = w.fallbackContentType()
+	} else if err := validateContentType(contentType); err != nil {
+		if !w.failed() {
+			w.setErr(fieldname, fmt.Errorf("invalid content type %q: %w", contentType, err))
+		}
+		return w
+	}
+	return w.writeFile(fieldname, filename, r, fileOpts{contentType: contentType})
+}
+
+// WriteReaderDetect creates a part with the given fieldname and filename and streams r into the part,
+// detecting its content type like [Writer.WriteFile] does, even if the detection is turned off
+// with [Writer.DetectContentType]. Unlike [Writer.WriteReader], which passes r through as is,
+// it has to peek at the beginning of r first: up to 3072 bytes (see [Writer.SetDetectLimit])
+// are buffered in memory before anything is written into the part
+func (w *Writer) WriteReaderDetect(fieldname, filename string, r io.Reader) *Writer {
+	return w.writeFile(fieldname, filename, r, fileOpts{detect: true})
+}
+
+// WriteSizedReader works like [Writer.WriteFile], but also sets the "Content-Length" header to size,
+// for servers and proxies that read it. R must have exactly size bytes, otherwise an error is recorded.
+// If size is negative, it's considered unknown and the header is not set
+func (w *Writer) WriteSizedReader(fieldname, filename string, r io.Reader, size int64) *Writer {
+	if size < 0 {
+		return w.writeFile(fieldname, filename, r, fileOpts{})
+	}
+	if r != nil {
+		r = &sizedReader{r: r, left: size, size: size, fieldname: fieldname}
+	}
+	return w.writeFile(fieldname, filename, r, fileOpts{header: contentLength(size)})
+}
+
+// WriteFileRange works like [Writer.WriteSizedReader], but writes exactly length bytes of r starting at off,
+// e.g. for chunked or resumable uploads. The content type is detected from the leading bytes of the range.
+// An error is recorded if the range is invalid or exceeds the source
+func (w *Writer) WriteFileRange(fieldname, filename string, r io.ReaderAt, off, length int64) *Writer {
+	if !w.failed() {
+		if r == nil {
+			return w.writeFile(fieldname, filename, nil, fileOpts{})
+		}
+		if off < 0 || length < 0 {
+			w.setErr(fieldname, fmt.Errorf("invalid range %d-%d for field %s", off, off+length, fieldname))
+			return w
+		}
+		if s, ok := r.(interface{ Size() int64 }); ok && off+length > s.Size() {
+			w.setErr(fieldname, fmt.Errorf("range %d-%d exceeds the source of %d bytes for field %s", off, off+length, s.Size(), fieldname))
+			return w
+		}
+		return w.WriteSizedReader(fieldname, filename, io.NewSectionReader(r, off, length), length)
+	}
+	return w
+}
+
+// WriteFileChunk works like [Writer.WriteSizedReader], but writes the chunk of a bigger file
+// for chunked or resumable uploads, setting the "Content-Range" header to "bytes start-end/total".
+// Like in HTTP, rangeEnd is inclusive, so it must hold that 0 <= rangeStart <= rangeEnd < total,
+// and chunk must have exactly rangeEnd-rangeStart+1 bytes, otherwise an error is recorded
+func (w *Writer) WriteFileChunk(fieldname, filename string, chunk io.Reader, rangeStart, rangeEnd, total int64) *Writer {
+	if !w.failed() {
+		if rangeStart < 0 || rangeStart > rangeEnd || rangeEnd >= total {
+			w.setErr(fieldname, fmt.Errorf("invalid range %d-%d/%d for field %s", rangeStart, rangeEnd, total, fieldname))
+			return w
+		}
+
+		size := rangeEnd - rangeStart + 1
+		if chunk != nil {
+			chunk = &sizedReader{r: chunk, left: size, size: size, fieldname: fieldname}
+		}
+		h := contentLength(size)
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rangeStart, rangeEnd, total))
+		return w.writeFile(fieldname, filename, chunk, fileOpts{header: h})
+	}
+	return w
+}
+
+// WriteFileContext works like [Writer.WriteFile], but copies the file in chunks
+// and checks ctx between them, so the write can be interrupted by canceling ctx.
+// In this case, the error returned by ctx.Err() is recorded
+func (w *Writer) WriteFileContext(ctx context.Context, fieldname, filename string, file io.Reader) *Writer {
+	return w.writeFile(fieldname, filename, file, fileOpts{ctx: ctx})
+}
+
+// WriteFileProgress works like [Writer.WriteFile], but copies the file in chunks
+// and calls onProgress with the total amount of bytes written after each of them.
+// OnProgress runs on the calling goroutine, so it shouldn't block. It's never called after an error.
+// It may call the getters of w, but must not write into it. A nil onProgress is allowed
+func (w *Writer) WriteFileProgress(fieldname, filename string, file io.Reader, onProgress func(written int64)) *Writer {
+	return w.writeFile(fieldname, filename, file, fileOpts{onProgress: onProgress})
+}
+
+// WriteBase64 creates a file part with the given fieldname and filename,
+// and writes data encoded with [base64.StdEncoding] into it,
+// setting the "Content-Transfer-Encoding" header to "base64".
+// The encoded lines are broken after every 76 characters with CRLF, as RFC 2045 requires.
+// The content type is detected from data like in [Writer.WriteFile]
+func (w *Writer) WriteBase64(fieldname, filename string, data []byte) *Writer {
+	return w.writeFile(fieldname, filename, bytes.NewReader(data), fileOpts{
+		header: textproto.MIMEHeader{"Content-Transfer-Encoding": {"base64"}},
+		encode: func(part io.Writer) io.WriteCloser {
+			return base64.NewEncoder(base64.StdEncoding, &lineWriter{w: part, limit: base64LineLength})
+		},
+	})
+}
+
+// WriteFileChecksum works like [Writer.WriteFile], but also computes the checksum of the file with h
+// and sets the headerName header of the part to it, e.g. "X-Checksum-SHA256" with [crypto/sha256.New].
+// The checksum is hex encoded, except for "Content-MD5", which is base64 encoded as RFC 1864 requires.
+// Since the header must precede the content, the whole file is read into memory first,
+// so it should only be used for reasonably small files. H is reset before use
+func (w *Writer) WriteFileChecksum(fieldname, filename string, file io.Reader, h hash.Hash, headerName string) *Writer {
+	if !w.failed() {
+		if file == nil {
+			return w.writeFile(fieldname, filename, nil, fileOpts{})
+		}
+		if h == nil {
+			w.setErr(fieldname, fmt.Errorf("nil hash for field %s", fieldname))
+			return w
+		}
+		if headerName == "" {
+			w.setErr(fieldname, fmt.Errorf("empty checksum header name for field %s", fieldname))
+			return w
+		}
+
+		if w.maxFile > 0 {
+			file = &limitReader{r: file, left: w.maxFile, fieldname: fieldname}
+		}
+		h.Reset()
+		data, err := io.ReadAll(io.TeeReader(file, h))
+		if err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+
+		headerName = textproto.CanonicalMIMEHeaderKey(headerName)
+		sum := hex.EncodeToString(h.Sum(nil))
+		if headerName == "Content-Md5" {
+			sum = base64.StdEncoding.EncodeToString(h.Sum(nil))
+		}
+		return w.writeFile(fieldname, filename, bytes.NewReader(data), fileOpts{
+			header: textproto.MIMEHeader{headerName: {sum}},
+		})
+	}
+	return w
+}
+
+// WriteMarshalerFile creates a file part with the given fieldname and filename
+// and writes the result of m.MarshalBinary() into it, detecting the content type like [Writer.WriteFile].
+// M can't be nil
+func (w *Writer) WriteMarshalerFile(fieldname, filename string, m encoding.BinaryMarshaler) *Writer {
+	if !w.failed() {
+		if isNil(m) {
+			w.setErr(fieldname, fmt.Errorf("nil encoding.BinaryMarshaler for field %s", fieldname))
+			return w
+		}
+		b, err := m.MarshalBinary()
+		if err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		return w.writeFile(fieldname, filename, bytes.NewReader(b), fileOpts{header: contentLength(int64(len(b)))})
+	}
+	return w
+}
+
+// WriteCSV creates a file part with the given fieldname and filename,
+// and writes records into it using [csv.Writer], with "Content-Type" set to "text/csv".
+// Empty records produce an empty file
+func (w *Writer) WriteCSV(fieldname, filename string, records [][]string) *Writer {
+	if !w.failed() {
+		fieldname = w.fieldName(fieldname)
+		if err := validateFieldName(fieldname); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		filename = w.fileName(filename)
+		if err := validateFileName(filename); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+
+		return w.writePart(fieldname, fileFieldHeader(fieldname, filename, "text/csv"), func(part io.Writer) error {
+			return csv.NewWriter(part).WriteAll(records)
+		})
+	}
+	return w
+}
+
+// WriteJSONFile creates a file part with the given fieldname and filename, e.g. "metadata.json",
+// and writes v as JSON encoded value, with "Content-Type" set to "application/json".
+// Unlike [Writer.WriteJSON], which writes an inline field, the part is sent as a file. V can't be nil
+func (w *Writer) WriteJSONFile(fieldname, filename string, v any) *Writer {
+	if !w.failed() {
+		fieldname = w.fieldName(fieldname)
+		if err := validateFieldName(fieldname); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		filename = w.fileName(filename)
+		if err := validateFileName(filename); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		if v == nil {
+			w.setErr(fieldname, fmt.Errorf("empty field value"))
+			return w
+		}
+
+		b, err := w.marshalJSON(v, "", "")
+		if err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+
+		return w.writePart(fieldname, fileFieldHeader(fieldname, filename, "application/json"), func(part io.Writer) error {
+			_, err := part.Write(b)
+			return err
+		})
+	}
+	return w
+}
+
+// WriteFileGzip works like [Writer.WriteFile], but compresses the file with gzip on the fly
+// and sets the "Content-Encoding" header to "gzip". The content type still describes
+// the uncompressed file. The server must support gzip-encoded parts
+func (w *Writer) WriteFileGzip(fieldname, filename string, file io.Reader) *Writer {
+	return w.writeFile(fieldname, filename, file, fileOpts{
+		header: textproto.MIMEHeader{"Content-Encoding": {"gzip"}},
+		encode: func(part io.Writer) io.WriteCloser {
+			return gzip.NewWriter(part)
+		},
+	})
+}
+
+// fileOpts holds the optional parameters of [Writer.writeFile]
+type fileOpts struct {
+	contentType string               // skips the detection if not empty
+	header      textproto.MIMEHeader // merged into the generated header
+	ctx         context.Context      // checked between chunks if not nil
+	onProgress  func(written int64)  // called after each chunk if not nil
+	detect      bool                 // detects the content type even if w.detectCt is false
+	disposition string               // replaces "form-data" in the "Content-Disposition" if not empty
+	noFilename  bool                 // omits the filename parameter, filename must be empty
+
+	// dispositionParams are appended to the "Content-Disposition" if not empty,
+	// so they must start with "; "
+	dispositionParams string
+
+	// close is called after the file is copied if not nil,
+	// its error is joined with the error of copying
+	close func() error
+
+	// encode wraps the part if not nil, e.g. to encode the file.
+	// The returned writer is closed after the file is copied
+	encode func(part io.Writer) io.WriteCloser
+}
+
+// writeFile streams file into a new file part
+func (w *Writer) writeFile(fieldname, filename string, file io.Reader, opts fileOpts) *Writer {
+	if !w.failed() {
+		fieldname = w.fieldName(fieldname)
+		if err := validateFieldName(fieldname); err != nil {
+			w.setErr(fieldname, err)
+			return w
+		}
+		if !opts.noFilename {
+			filename = w.fileName(filename)
+			if err := validateFileName(filename); err != nil {
+				w.setErr(fieldname, err)
+				return w
+			}
+		}
+		if file == nil {
+			w.setErr(fieldname, fmt.Errorf("empty file reader"))
+			return w
+		}
+		// a canceled context must not leave a part with only the header written
+		if opts.ctx != nil {
+			if err := opts.ctx.Err(); err != nil {
+				w.setErr(fieldname, err)
+				return w
+			}
+		}
+
+		if w.maxFile > 0 {
+			file = &limitReader{r: file, left: w.maxFile, fieldname: fieldname}
+		}
+
+		var err error
+		ct := opts.contentType
+		if ct == "" && (w.detectCt || opts.detect) {
+			file, ct, err = w.detect(file, filename)
+			if err != nil {
+				w.setErr(fieldname, err)
+				return w
+			}
+			if w.extFallback && (ct == "" || ct == defaultContentType) {
+				ct = mime.TypeByExtension(filepath.Ext(filename))
+			}
+		}
+		if ct == "" || ct == defaultContentType {
+			ct = w.fallbackContentType()
+		}
+
+		h := fileFieldHeader(fieldname, filename, ct)
+		if opts.noFilename {
+			h = textFieldHeader(fieldname)
+			h.Set("Content-Type", ct)
+		}
+		if opts.disposition != "" {
+			cd := h.Get("Content-Disposition")
+			h.Set("Content-Disposition", opts.disposition+strings.TrimPrefix(cd, "form-data"))
+		}
+		if opts.dispositionParams != "" {
+			h.Set("Content-Disposition", h.Get("Content-Disposition")+opts.dispositionParams)
+		}
+		for k, v := range opts.header {
+			h[textproto.CanonicalMIMEHeaderKey(k)] = v
+		}
+		return w.writePart(fieldname, h, func(part io.Writer) error {
+			err := writeEncoded(part, file, opts)
+			if opts.close != nil {
+				if cerr := opts.close(); cerr != nil {
+					err = errors.Join(err, fmt.Errorf("can't close file for field %s: %w", fieldname, cerr))
+				}
+			}
+			return err
+		})
+	}
+	return w
+}
+
+// writeEncoded copies src to dst, encoding it if opts require it
+func writeEncoded(dst io.Writer, src io.Reader, opts fileOpts) error {
+	if opts.encode == nil {
+		return copyFile(dst, src, opts)
+	}
+	enc := opts.encode(dst)
+	err := copyFile(enc, src, opts)
+	if cerr := enc.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// copyFile copies src to dst, chunk by chunk if opts require it
+func copyFile(dst io.Writer, src io.Reader, opts fileOpts) error {
+	if opts.ctx == nil && opts.onProgress == nil {
+		_, err := io.Copy(dst, src)
+		return err
+	}
+
+	var written int64
+	buf := make([]byte, copyChunkSize)
+	for {
+		if opts.ctx != nil {
+			if err := opts.ctx.Err(); err != nil {
+				return err
+			}
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			written += int64(n)
+			if opts.onProgress != nil {
+				opts.onProgress(written)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// CreatePart is a wrapper around [multipart.Writer.CreatePart] for cases not covered by other methods.
+// If an error was already recorded, it's returned instead of creating a part.
+// Otherwise, the error of creating the part is recorded, but errors of writing
+// to the returned writer are not, so they must be handled by the caller.
+// Writing to the returned writer is never guarded in concurrency safe mode
+func (w *Writer) CreatePart(header textproto.MIMEHeader) (io.Writer, error) {
+	if w.failed() {
+		return nil, w.Err()
+	}
+
+	var fieldname string
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		fieldname = params["name"]
+	}
+	unlock := w.lock()
+	part, err := w.createPart(fieldname, header)
+	unlock()
+	if err != nil {
+		w.setErr(fieldname, err)
+		return nil, err
+	}
+	return part, nil
+}
+
+// CreateFormFile mirrors [multipart.Writer.CreateFormFile]: it creates a file part
+// with the given fieldname and filename, which the caller fills through the returned writer,
+// e.g. generating the content incrementally. The names are validated and the errors are recorded
+// like with [Writer.CreatePart]. Since the content is not known when the part is created,
+// the detection is impossible and the fallback content type ("application/octet-stream" by default) is used
+func (w *Writer) CreateFormFile(fieldname, filename string) (io.Writer, error) {
+	if w.failed() {
+		return nil, w.Err()
+	}
+	fieldname = w.fieldName(fieldname)
+	if err := validateFieldName(fieldname); err != nil {
+		w.setErr(fieldname, err)
+		return nil, err
+	}
+	filename = w.fileName(filename)
+	if err := validateFileName(filename); err != nil {
+		w.setErr(fieldname, err)
+		return nil, err
+	}
+	return w.CreatePart(fileFieldHeader(fieldname, filename, w.fallbackContentType()))
+}
+
+// Err returns the first error occurred while writing any fields, without closing the writer.
+// If collecting of all errors is turned on, it returns all of them joined with [errors.Join].
+// It only reflects write-time errors, not the result of [Writer.Close]
+func (w *Writer) Err() error {
+	defer w.stateLock()()
+	if w.collectAll {
+		return errors.Join(w.errs...)
+	}
+	return w.firstErr
+}
+
+// Errors returns every error occurred while writing any fields.
+// Unless collecting of all errors is turned on, it contains at most one error
+func (w *Writer) Errors() []error {
+	defer w.stateLock()()
+	return slices.Clone(w.errs)
+}
+
+// Flush writes the parts deferred so far (see [Writer.WriteFileLazy]) in the order they were registered,
+// and returns the same error as [Writer.Err], leaving the writer open for more parts.
+// The parts written after Flush follow the flushed ones. If nothing was deferred,
+// it's a no-op only returning the error. The writes are not buffered by w,
+// so Flush doesn't flush the destination the writer was created with
+func (w *Writer) Flush() error {
+	w.writePending()
+	return w.Err()
+}
+
+// Close flushes the deferred parts like [Writer.Flush] and writes the closing boundary.
+// It returns the first error occurred while writing any fields
+// (or all of them, if collecting of all errors is turned on),
+// or the result of [multipart.Writer.Close]. Closing an already closed writer is a no-op,
+// while writing any fields after closing records an error, since they would follow the closing boundary
+func (w *Writer) Close() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	defer w.lock()()
+	if w.closed {
+		return nil
+	}
+	if err := w.mw.Close(); err != nil {
+		return err
+	}
+	unlock := w.stateLock()
+	w.closed = true
+	unlock()
+	return nil
+}
+
+// Closed reports whether the closing boundary was written by [Writer.Close],
+// so the body is complete
+func (w *Writer) Closed() bool {
+	defer w.stateLock()()
+	return w.closed
+}
+
+// CloseAndType closes the writer and returns its content type (see [Writer.FormDataContentType]),
+// so they can't be used in the wrong order. If any error occurred while writing or closing, it's returned instead
+func (w *Writer) CloseAndType() (string, error) {
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return w.FormDataContentType(), nil
+}
+
+// checkClosed records an error in strict mode if w is not closed yet
+func (w *Writer) checkClosed(method string) {
+	if w.strictClose && !w.Closed() {
+		w.setErr("", fmt.Errorf("%s called before Close", method))
+	}
+}
+
+// writePending makes the deferred writes in order, stopping at the first error
+func (w *Writer) writePending() {
+	unlock := w.stateLock()
+	pending, closed := w.pending, w.closed
+	w.pending = nil
+	unlock()
+
+	if closed && len(pending) > 0 {
+		w.setErr("", fmt.Errorf("%d deferred fields written after Close", len(pending)))
+		return
+	}
+	for _, write := range pending {
+		if w.failed() {
+			return
+		}
+		write()
+	}
+}
+
+// NewRequest closes the writer and returns a new [http.Request] with body as its body
+// and the "Content-Type" header set to [Writer.FormDataContentType].
+// Body is expected to be the destination the writer was created with (e.g. a [bytes.Buffer]);
+// it is owned by the returned request from now on and must not be written to anymore.
+// If any error occurred while writing or closing, it's returned instead
+func (w *Writer) NewRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req, nil
+}
+
+// finite reports whether f can be written, recording an error if it can't
+func (w *Writer) finite(fieldname string, f float64) bool {
+	if w.failed() {
+		return false
+	}
+	if w.rejectNaN && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		w.setErr(fieldname, fmt.Errorf("non-finite value %v for field %s", f, fieldname))
+		return false
+	}
+	return true
+}
+
+// fallbackContentType returns the content type of file parts used when it's unknown
+func (w *Writer) fallbackContentType() string {
+	if w.fallbackCt != "" {
+		return w.fallbackCt
+	}
+	return defaultContentType
+}
+
+// createPart is a wrapper around [multipart.Writer.CreatePart] counting the created parts
+// and checking fieldname for duplicates in strict mode. Every part must be created through it
+func (w *Writer) createPart(fieldname string, h textproto.MIMEHeader) (io.Writer, error) {
+	if w.closed {
+		return nil, fmt.Errorf("field %s written after Close", fieldname)
+	}
+	if w.maxParts > 0 && w.parts >= w.maxParts {
+		return nil, fmt.Errorf("field %s exceeds the limit of %d parts", fieldname, w.maxParts)
+	}
+	if w.strictNames && !w.repeatable[fieldname] {
+		if w.seen[fieldname] {
+			return nil, fmt.Errorf("duplicate field name %s", fieldname)
+		}
+		if w.seen == nil {
+			w.seen = make(map[string]bool)
+		}
+		w.seen[fieldname] = true
+	}
+
+	part, err := w.mw.CreatePart(h)
+	if err != nil {
+		return nil, err
+	}
+	unlock := w.stateLock()
+	w.parts++
+	unlock()
+	return part, nil
+}
+
+// writePart creates a part with the header h and calls write to fill it, recording any error.
+// In concurrency safe mode, w stays locked until the part is written
+func (w *Writer) writePart(fieldname string, h textproto.MIMEHeader, write func(part io.Writer) error) *Writer {
+	w.setErr(fieldname, w.tryWritePart(fieldname, h, write))
+	return w
+}
+
+// tryWritePart is [Writer.writePart] returning the error instead of recording it
+func (w *Writer) tryWritePart(fieldname string, h textproto.MIMEHeader, write func(part io.Writer) error) error {
+	var size int64
+	err := func() error {
+		defer w.lock()()
+
+		part, err := w.createPart(fieldname, h)
+		if err != nil {
+			return err
+		}
+		if w.partHook == nil {
+			return write(part)
+		}
+		cw := &countWriter{w: part}
+		err = write(cw)
+		size = cw.written.Load()
+		return err
+	}()
+	if err != nil {
+		return err
+	}
+
+	if w.partHook != nil {
+		var filename string
+		if _, params, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil {
+			filename = params["filename"]
+		}
+		w.partHook(fieldname, filename, h.Get("Content-Type"), size)
+	}
+	return nil
+}
+
+// lock locks w in concurrency safe mode and returns the function unlocking it
+func (w *Writer) lock() (unlock func()) {
+	if !w.safe {
+		return func() {}
+	}
+	w.mu.Lock()
+	return w.mu.Unlock
+}
+
+// stateLock locks the state of w in concurrency safe mode and returns the function unlocking it.
+// Unlike [Writer.lock], it's never held while calling user code, and may be taken while holding w.mu, but not vice versa
+func (w *Writer) stateLock() (unlock func()) {
+	if !w.safe {
+		return func() {}
+	}
+	w.smu.Lock()
+	return w.smu.Unlock
+}
+
+// failed reports whether the following writes should be skipped.
+// Once the destination fails, nothing is written anymore even if collecting of all errors is turned on,
+// since the body is already broken
+func (w *Writer) failed() bool {
+	unlock := w.lock()
+	broken := w.cw.err != nil
+	unlock()
+
+	defer w.stateLock()()
+	return broken || (w.firstErr != nil && !w.collectAll)
+}
+
+// setErr records err, if it's not nil, as occurred while writing fieldname.
+// Unless collecting of all errors is turned on, only the first error is kept.
+// In must mode, it panics instead
+func (w *Writer) setErr(fieldname string, err error) {
+	if err == nil {
+		return
+	}
+	if w.must {
+		if fieldname == "" {
+			panic(fmt.Errorf("formy: %w", err))
+		}
+		panic(fmt.Errorf("formy: field %s: %w", fieldname, err))
+	}
+
+	defer w.stateLock()()
+	if w.firstErr != nil && !w.collectAll {
+		return
+	}
+	if w.firstErr == nil {
+		w.firstErr = err
+	}
+	w.errs = append(w.errs, err)
+}
+
+// detect peeks at the first bytes of r and returns their MIME type.
+// The returned reader must be used instead of r, since it still holds the peeked bytes
+func (w *Writer) detect(r io.Reader, filename string) (io.Reader, string, error) {
+	limit := w.detectLimit
+	if limit <= 0 {
+		limit = defaultDetectLimit
+	}
+	br := bufio.NewReaderSize(r, limit)
+	peek, err := br.Peek(limit)
+	if err != nil && err != io.EOF {
+		return nil, "", err
+	}
+	if w.detector != nil {
+		ct := w.detector(peek, filename)
+		if validateContentType(ct) != nil {
+			ct = ""
+		}
+		return br, ct, nil
+	}
+	return br, mimetype.Detect(peek).String(), nil
+}
+
+// countWriter counts the bytes written to w and fails once the limit is exceeded.
+// It remembers the first error, either of exceeding the limit or returned by w, and fails all the following writes with it
+type countWriter struct {
+	w       io.Writer
+	written atomic.Int64 // read without locking, see [Writer.Written]
+	limit   int64
+	err     error
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.limit > 0 && c.written.Load()+int64(len(p)) > c.limit {
+		c.err = fmt.Errorf("%w: exceeds %d bytes", ErrBodyTooLarge, c.limit)
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.written.Add(int64(n))
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// base64LineLength is the maximum length of base64 encoded lines defined in RFC 2045
+const base64LineLength = 76
+
+// lineWriter breaks the content written to w into lines of at most limit bytes separated with CRLF
+type lineWriter struct {
+	w     io.Writer
+	limit int
+	col   int
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		if l.col == l.limit {
+			if _, err := io.WriteString(l.w, "\r\n"); err != nil {
+				return n, err
+			}
+			l.col = 0
+		}
+		m, err := l.w.Write(p[:min(len(p), l.limit-l.col)])
+		n += m
+		l.col += m
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// limitReader fails once more than the allowed amount of bytes is read from r
+type limitReader struct {
+	r         io.Reader
+	left      int64
+	fieldname string
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	// reading one byte more than allowed to find out if there's anything left
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.left {
+		n = int(l.left)
+		l.left = 0
+		return n, fmt.Errorf("field %s: %w", l.fieldname, ErrFileTooLarge)
+	}
+	l.left -= int64(n)
+	return n, err
+}
+
+// fieldName returns fieldname transformed by w.nameFunc, if it's set
+func (w *Writer) fieldName(fieldname string) string {
+	if w.nameFunc == nil {
+		return fieldname
+	}
+	return w.nameFunc(fieldname)
+}
+
+// fileName returns filename decoded if decoding of file names is turned on
+func (w *Writer) fileName(filename string) string {
+	if !w.decodeNames {
+		return filename
+	}
+	if decoded, err := url.PathUnescape(filename); err == nil {
+		return decoded
+	}
+	return filename
+}
+
+// validateContentType checks that ct is a valid media type having both type and subtype,
+// since [mime.ParseMediaType] accepts a bare type like "text"
+func validateContentType(ct string) error {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return err
+	}
+	if typ, sub, _ := strings.Cut(mt, "/"); typ == "" || sub == "" {
+		return errors.New("missing subtype")
+	}
+	return nil
+}
+
+// extensionByType returns the usual extension of files with the content type ct, with the leading dot,
+// or an empty string if it's unknown
+func extensionByType(ct string) string {
+	if mt := mimetype.Lookup(ct); mt != nil {
+		return mt.Extension()
+	}
+	if mt, _, err := mime.ParseMediaType(ct); err == nil {
+		if exts, _ := mime.ExtensionsByType(mt); len(exts) > 0 {
+			return exts[0]
+		}
+	}
+	return ""
+}
+
+// isNil reports whether v is nil or holds a nil pointer, which would panic in the methods with value receivers
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
+
+// validateFieldName checks that fieldname is not empty
+// and contains no control characters, which could be used to inject headers
+func validateFieldName(fieldname string) error {
+	if fieldname == "" {
+		return fmt.Errorf("empty field name")
+	}
+	if hasControlChars(fieldname) {
+		return fmt.Errorf("invalid field name %q: contains control characters", fieldname)
+	}
+	return nil
+}
+
+// validateFileName checks that filename is not empty
+// and contains no control characters, which could be used to inject headers
+func validateFileName(filename string) error {
+	if filename == "" {
+		return fmt.Errorf("empty file name")
+	}
+	if hasControlChars(filename) {
+		return fmt.Errorf("invalid file name %q: contains control characters", filename)
+	}
+	return nil
+}
+
+func hasControlChars(s string) bool {
+	return strings.ContainsFunc(s, unicode.IsControl)
+}
+
+// sizedReader fails if r doesn't have exactly size bytes
+type sizedReader struct {
+	r         io.Reader
+	left      int64
+	size      int64
+	fieldname string
+}
+
+func (s *sizedReader) Read(p []byte) (int, error) {
+	// reading one byte more than expected to find out if there's anything left
+	if int64(len(p)) > s.left+1 {
+		p = p[:s.left+1]
+	}
+	n, err := s.r.Read(p)
+	if int64(n) > s.left {
+		return int(s.left), fmt.Errorf("file for field %s is larger than %d bytes", s.fieldname, s.size)
+	}
+	s.left -= int64(n)
+	if err == io.EOF && s.left > 0 {
+		return n, fmt.Errorf("file for field %s is smaller than %d bytes", s.fieldname, s.size)
+	}
+	return n, err
+}
+
+// contentLength returns a header with "Content-Length" set to size
+func contentLength(size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{"Content-Length": {strconv.FormatInt(size, 10)}}
+}
+
+// statLength returns a header with "Content-Length" set to the size of f,
+// or nil if f is not a regular file or its size is unknown
+func statLength(f fs.File) textproto.MIMEHeader {
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	return contentLength(info.Size())
+}
+
+func textFieldHeader(fieldname string) textproto.MIMEHeader {
+	h := textproto.MIMEHeader{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(fieldname))},
+	}
+	return h
+}
+
+// textHeader returns the header of a text field, with the content type if it was set
+func (w *Writer) textHeader(fieldname string) textproto.MIMEHeader {
+	h := textFieldHeader(fieldname)
+	if w.textCt != "" {
+		h.Set("Content-Type", w.textCt)
+	}
+	return h
+}
+
+func jsonFieldHeader(fieldname string) textproto.MIMEHeader {
+	h := textFieldHeader(fieldname)
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	return h
+}
+
+// xmlFieldHeader returns the header of a text field with the XML content type
+func xmlFieldHeader(fieldname string) textproto.MIMEHeader {
+	h := textFieldHeader(fieldname)
+	h.Set("Content-Type", "application/xml")
+	return h
+}
+
+// fileFieldHeader returns the header of a file part.
+// If filename contains non-ASCII characters, the "filename*" parameter is added
+// with the percent-encoded filename as defined in RFC 5987,
+// while the plain "filename" one is kept for legacy readers
+func fileFieldHeader(fieldname, filename, contentType string) textproto.MIMEHeader {
+	cd := fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(fieldname), escapeQuotes(filename))
+	if !isASCII(filename) {
+		cd += "; filename*=UTF-8''" + encodeExtValue(filename)
+	}
+	h := textproto.MIMEHeader{
+		"Content-Disposition": {cd},
+		"Content-Type":        {contentType},
+	}
+	return h
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeExtValue percent-encodes every byte of s except attr-char as defined in RFC 5987
+func encodeExtValue(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0F])
+	}
+	return b.String()
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
 }
 
-var quoteReplacer = strings.NewReplacer("\\", "\\\\", `"`, "\\\\")
+var quoteReplacer = strings.NewReplacer("\\", "\\\\", `"`, "\\\"", "\r", "%0D", "\n", "%0A")
 
+// escapeQuotes escapes the field parameter values the same way [multipart.Writer] does:
+// '"' and '\' are backslash-escaped, and CR and LF are percent-encoded as WHATWG suggests.
+// Percent-encoding '"' too, as WHATWG also suggests, would break the round trip
+// with [multipart.Reader] and other servers unescaping backslashes, so it's not done.
+// Note that validateFieldName and validateFileName reject control characters anyway
 func escapeQuotes(raw string) string {
 	return quoteReplacer.Replace(raw)
 }
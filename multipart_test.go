@@ -2,10 +2,40 @@ package formy_test
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"math"
+	"mime"
 	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"testing/iotest"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/bigelle/formy"
 	"github.com/stretchr/testify/assert"
@@ -64,3 +94,2887 @@ func TestWriter_AnyWrites(t *testing.T) {
 		}
 	}
 }
+
+func TestWriter_EscapeQuotes(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	filename := `my"weird".txt`
+	err := w.WriteFile("file", filename, strings.NewReader("TEST")).Close()
+
+	if assert.NoError(t, err) {
+		r := multipart.NewReader(buf, w.Boundary())
+		part, err := r.NextPart()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "file", part.FormName())
+			assert.Equal(t, filename, part.FileName())
+		}
+	}
+}
+
+func TestWriter_EscapeQuotesStdlib(t *testing.T) {
+	names := []string{`a"b`, `a\b`, `\"`, `a;b=c`, `"quoted"`, "a%0Db", "trailing\\"}
+
+	for _, name := range names {
+		want := bytes.NewBuffer(nil)
+		mw := multipart.NewWriter(want)
+		mw.SetBoundary("boundary")
+		_, err := mw.CreateFormFile(name, name+".txt")
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.NoError(t, mw.WriteField(name, "text"))
+		assert.NoError(t, mw.Close())
+
+		got := bytes.NewBuffer(nil)
+		w := formy.NewWriterWith(got, formy.WithBoundary("boundary"))
+		w.SetFallbackContentType("application/octet-stream")
+		w.DetectContentType(false)
+		w.WriteFile(name, name+".txt", strings.NewReader("")).
+			WriteString(name, "text")
+		if assert.NoError(t, w.Close()) {
+			assert.Equal(t, want.String(), got.String(), name)
+
+			parts := readParts(t, got, "boundary")
+			if assert.Len(t, parts, 2) {
+				assert.Equal(t, name, parts[0].name)
+				assert.Equal(t, name+".txt", parts[0].filename)
+			}
+		}
+	}
+}
+
+func TestWriter_WriteReaderDetect(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+	w.DetectContentType(false)
+
+	err := w.WriteReaderDetect("doc", "doc.pdf", strings.NewReader("%PDF-1.4")).
+		WriteFile("file", "doc.pdf", strings.NewReader("%PDF-1.4")).
+		Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 2) {
+			assert.Equal(t, "application/pdf", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, "%PDF-1.4", parts[0].body)
+			assert.Equal(t, "application/octet-stream", parts[1].header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestWriter_WriteReader(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteReader("audio", "voice.ogg", strings.NewReader("OggS"), "audio/ogg").
+		WriteReader("blob", "blob.bin", strings.NewReader("BLOB"), "").
+		Close()
+
+	if assert.NoError(t, err) {
+		r := multipart.NewReader(buf, w.Boundary())
+
+		part, err := r.NextPart()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "audio", part.FormName())
+			assert.Equal(t, "voice.ogg", part.FileName())
+			assert.Equal(t, "audio/ogg", part.Header.Get("Content-Type"))
+			b, err := io.ReadAll(part)
+			assert.NoError(t, err)
+			assert.Equal(t, "OggS", string(b))
+		}
+
+		part, err = r.NextPart()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "blob", part.FormName())
+			assert.Equal(t, "application/octet-stream", part.Header.Get("Content-Type"))
+			b, err := io.ReadAll(part)
+			assert.NoError(t, err)
+			assert.Equal(t, "BLOB", string(b))
+		}
+	}
+
+	buf.Reset()
+	w = formy.NewWriter(buf)
+	err = w.WriteReader("f", "a.txt", strings.NewReader("TEXT"), "text/plain\r\nX-Evil: 1").Close()
+	assert.ErrorContains(t, err, "invalid content type")
+	assert.NotContains(t, buf.String(), "X-Evil")
+}
+
+// zeroReader produces n zero bytes and counts how many were read
+type zeroReader struct {
+	n    int64
+	read int64
+}
+
+func (r *zeroReader) Read(p []byte) (int, error) {
+	if r.read >= r.n {
+		return 0, io.EOF
+	}
+	if rem := r.n - r.read; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+	clear(p)
+	r.read += int64(len(p))
+	return len(p), nil
+}
+
+func TestWriter_WriteFileStreaming(t *testing.T) {
+	const size = 50 << 20
+	src := &zeroReader{n: size}
+	w := formy.NewWriter(io.Discard)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	err := w.WriteFile("file", "zeros.bin", src).Close()
+
+	runtime.ReadMemStats(&after)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(size), src.read)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(size/10))
+}
+
+func TestWriter_Err(t *testing.T) {
+	w := formy.NewWriter(io.Discard)
+
+	assert.NoError(t, w.WriteString("string", "text").Err())
+	assert.Error(t, w.WriteJSON("", 42).Err())
+	assert.Error(t, w.WriteString("string", "text").Err())
+}
+
+func TestWriter_CollectAllErrors(t *testing.T) {
+	w := formy.NewWriter(io.Discard)
+	w.CollectAllErrors(true)
+
+	err := w.WriteString("string", "text").
+		WriteInt("", 42).
+		WriteJSON("json", nil).
+		WriteFile("file", "", strings.NewReader("TEST")).
+		Close()
+
+	assert.Error(t, err)
+	assert.Len(t, w.Errors(), 3)
+	for _, e := range w.Errors() {
+		assert.ErrorIs(t, err, e)
+	}
+}
+
+// brokenWriter accepts n bytes and fails afterwards, counting the writes made after the failure
+type brokenWriter struct {
+	n     int
+	after int
+}
+
+var errBroken = errors.New("broken pipe")
+
+func (w *brokenWriter) Write(p []byte) (int, error) {
+	if w.n <= 0 {
+		w.after++
+		return 0, errBroken
+	}
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errBroken
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriter_BrokenDestination(t *testing.T) {
+	for _, collectAll := range []bool{false, true} {
+		dst := &brokenWriter{n: 1024}
+		w := formy.NewWriter(dst)
+		w.CollectAllErrors(collectAll)
+
+		var err error
+		assert.NotPanics(t, func() {
+			err = w.WriteString("string", "text").
+				WriteFile("file", "zeros.bin", &zeroReader{n: 1 << 20}).
+				WriteJSON("json", map[string]int{"a": 1}).
+				WriteString("after", "text").
+				Close()
+		})
+
+		assert.ErrorIs(t, err, errBroken)
+		assert.Len(t, w.Errors(), 1)
+		assert.Zero(t, dst.after)
+		assert.False(t, w.Closed())
+	}
+}
+
+func TestWriter_MarshalBeforeCreatingPart(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+	w.CollectAllErrors(true)
+
+	err := w.WriteJSON("json", make(chan int)).
+		WriteJSONIndent("indent", func() {}, "", "  ").
+		WriteXML("xml", make(chan int)).
+		WriteString("string", "text").
+		Close()
+
+	assert.Error(t, err)
+	assert.Len(t, w.Errors(), 3)
+	assert.Equal(t, 1, w.PartCount())
+	assert.Equal(t, 1, strings.Count(buf.String(), "Content-Disposition"))
+}
+
+func TestWriter_FirstErrorByDefault(t *testing.T) {
+	w := formy.NewWriter(io.Discard)
+
+	err := w.WriteInt("", 42).
+		WriteJSON("json", nil).
+		Close()
+
+	assert.EqualError(t, err, "empty field name")
+	assert.Len(t, w.Errors(), 1)
+
+	w = formy.NewWriter(io.Discard)
+	w.WriteString("", "text").
+		WriteFileClose("file", "file.txt", &closeTracker{Reader: strings.NewReader("TEXT"), err: errors.New("close failed")})
+	w.SetFallbackContentType("bad")
+	assert.EqualError(t, w.Close(), "empty field name")
+	assert.Len(t, w.Errors(), 1)
+}
+
+func TestWriter_WriteBytes(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteBytes("bytes", []byte("raw bytes")).
+		WriteBytesCond("skipped", []byte("nope"), func() bool { return false }).
+		Close()
+
+	if assert.NoError(t, err) {
+		r := multipart.NewReader(buf, w.Boundary())
+		part, err := r.NextPart()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "bytes", part.FormName())
+			b, err := io.ReadAll(part)
+			assert.NoError(t, err)
+			assert.Equal(t, "raw bytes", string(b))
+		}
+		_, err = r.NextPart()
+		assert.Equal(t, io.EOF, err)
+	}
+
+	assert.Error(t, formy.NewWriter(io.Discard).WriteBytes("", []byte("x")).Close())
+}
+
+func TestWriter_WriteInt64Uint64(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteInt64("int64", math.MaxInt64).
+		WriteInt64("minint64", math.MinInt64).
+		WriteUint64("uint64", math.MaxUint64).
+		WriteInt64Cond("skipped", 1, func() bool { return false }).
+		WriteUint64Cond("skipped", 1, func() bool { return false }).
+		Close()
+
+	if assert.NoError(t, err) {
+		want := map[string]string{
+			"int64":    "9223372036854775807",
+			"minint64": "-9223372036854775808",
+			"uint64":   "18446744073709551615",
+		}
+		r := multipart.NewReader(buf, w.Boundary())
+		for {
+			part, err := r.NextPart()
+			if err == io.EOF {
+				break
+			}
+			b, err := io.ReadAll(part)
+			assert.NoError(t, err)
+			assert.Equal(t, want[part.FormName()], string(b), part.FormName())
+			delete(want, part.FormName())
+		}
+		assert.Empty(t, want)
+	}
+}
+
+func TestWriter_WriteTime(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	ts := time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC)
+	err := w.WriteTime("rfc3339", ts, "").
+		WriteTime("date", ts, time.DateOnly).
+		WriteUnixTime("unix", ts).
+		WriteTimeCond("skipped", ts, "", func() bool { return false }).
+		WriteUnixTimeCond("skipped", ts, func() bool { return false }).
+		Close()
+
+	if assert.NoError(t, err) {
+		want := map[string]string{
+			"rfc3339": "2024-03-01T12:30:00Z",
+			"date":    "2024-03-01",
+			"unix":    "1709296200",
+		}
+		r := multipart.NewReader(buf, w.Boundary())
+		for {
+			part, err := r.NextPart()
+			if err == io.EOF {
+				break
+			}
+			b, err := io.ReadAll(part)
+			assert.NoError(t, err)
+			assert.Equal(t, want[part.FormName()], string(b), part.FormName())
+			delete(want, part.FormName())
+		}
+		assert.Empty(t, want)
+	}
+}
+
+func TestWriter_RejectZeroTime(t *testing.T) {
+	w := formy.NewWriter(io.Discard)
+	assert.NoError(t, w.WriteTime("time", time.Time{}, "").Close())
+
+	w = formy.NewWriter(io.Discard)
+	w.RejectZeroTime(true)
+	assert.Error(t, w.WriteTime("time", time.Time{}, "").Close())
+
+	w = formy.NewWriter(io.Discard)
+	w.RejectZeroTime(true)
+	assert.Error(t, w.WriteUnixTime("time", time.Time{}).Close())
+}
+
+func TestWriteSlice(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := formy.WriteSlice(w, "nums", []int{1, 2, 3}).Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		r := multipart.NewReader(buf, w.Boundary())
+		for {
+			part, err := r.NextPart()
+			if err == io.EOF {
+				break
+			}
+			assert.Equal(t, "nums", part.FormName())
+			b, err := io.ReadAll(part)
+			assert.NoError(t, err)
+			got = append(got, string(b))
+		}
+		assert.Equal(t, []string{"1", "2", "3"}, got)
+	}
+}
+
+type color int
+
+func (c color) String() string {
+	return [...]string{"red", "green", "blue"}[c]
+}
+
+func TestWriter_WriteStringer(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteStringer("color", color(2)).
+		WriteStringerCond("skipped", color(0), func() bool { return false }).
+		Close()
+
+	if assert.NoError(t, err) {
+		r := multipart.NewReader(buf, w.Boundary())
+		part, err := r.NextPart()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "color", part.FormName())
+			b, err := io.ReadAll(part)
+			assert.NoError(t, err)
+			assert.Equal(t, "blue", string(b))
+		}
+		_, err = r.NextPart()
+		assert.Equal(t, io.EOF, err)
+	}
+
+	assert.Error(t, formy.NewWriter(io.Discard).WriteStringer("color", nil).Close())
+
+	var u *url.URL
+	assert.NotPanics(t, func() {
+		err = formy.NewWriter(io.Discard).WriteStringer("url", u).Close()
+	})
+	assert.EqualError(t, err, "nil fmt.Stringer for field url")
+}
+
+type failingMarshaler struct{}
+
+func (failingMarshaler) MarshalText() ([]byte, error) {
+	return nil, errors.New("marshal failed")
+}
+
+func TestWriter_WriteTextMarshaler(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteTextMarshaler("addr", netip.MustParseAddr("192.168.0.1")).
+		WriteTextMarshalerCond("skipped", failingMarshaler{}, func() bool { return false }).
+		Close()
+
+	if assert.NoError(t, err) {
+		r := multipart.NewReader(buf, w.Boundary())
+		part, err := r.NextPart()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "addr", part.FormName())
+			b, err := io.ReadAll(part)
+			assert.NoError(t, err)
+			assert.Equal(t, "192.168.0.1", string(b))
+		}
+		_, err = r.NextPart()
+		assert.Equal(t, io.EOF, err)
+	}
+
+	err = formy.NewWriter(io.Discard).WriteTextMarshaler("fail", failingMarshaler{}).Close()
+	assert.EqualError(t, err, "marshal failed")
+
+	var addr *netip.Addr
+	assert.NotPanics(t, func() {
+		err = formy.NewWriter(io.Discard).WriteTextMarshaler("addr", addr).Close()
+	})
+	assert.EqualError(t, err, "nil encoding.TextMarshaler for field addr")
+}
+
+func TestWriter_WriteFileWithHeader(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	extra := textproto.MIMEHeader{
+		"X-File-Id":    {"42"},
+		"content-type": {"text/x-custom"},
+	}
+	err := w.WriteFileWithHeader("file", "file.txt", strings.NewReader("TEST"), extra).Close()
+
+	if assert.NoError(t, err) {
+		r := multipart.NewReader(buf, w.Boundary())
+		part, err := r.NextPart()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "file", part.FormName())
+			assert.Equal(t, "file.txt", part.FileName())
+			assert.Equal(t, "42", part.Header.Get("X-File-Id"))
+			assert.Equal(t, "text/x-custom", part.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestWriter_WriteFileAs(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteFileAs("voice", "voice.ogg", "audio/ogg", strings.NewReader("TEST")).Close()
+
+	if assert.NoError(t, err) {
+		r := multipart.NewReader(buf, w.Boundary())
+		part, err := r.NextPart()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "voice.ogg", part.FileName())
+			assert.Equal(t, "audio/ogg", part.Header.Get("Content-Type"))
+		}
+	}
+
+	err = formy.NewWriter(io.Discard).WriteFileAs("voice", "voice.ogg", "audio/", strings.NewReader("TEST")).Close()
+	assert.Error(t, err)
+
+	err = formy.NewWriter(io.Discard).WriteFileAs("voice", "voice.ogg", "audio", strings.NewReader("TEST")).Close()
+	assert.EqualError(t, err, `invalid content type "audio": missing subtype`)
+}
+
+func TestWriter_WriteFilePath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("TEST"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteFilePath("file", path).Close()
+
+	if assert.NoError(t, err) {
+		r := multipart.NewReader(buf, w.Boundary())
+		part, err := r.NextPart()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "file", part.FormName())
+			assert.Equal(t, "file.txt", part.FileName())
+			b, err := io.ReadAll(part)
+			assert.NoError(t, err)
+			assert.Equal(t, "TEST", string(b))
+		}
+	}
+
+	err = formy.NewWriter(io.Discard).WriteFilePath("file", filepath.Join(t.TempDir(), "missing.txt")).Close()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWriter_WriteFileFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"fixtures/file.txt": {Data: []byte("TEST")},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteFileFS(fsys, "file", "fixtures/file.txt").Close()
+
+	if assert.NoError(t, err) {
+		r := multipart.NewReader(buf, w.Boundary())
+		part, err := r.NextPart()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "file", part.FormName())
+			assert.Equal(t, "file.txt", part.FileName())
+			b, err := io.ReadAll(part)
+			assert.NoError(t, err)
+			assert.Equal(t, "TEST", string(b))
+		}
+	}
+
+	err = formy.NewWriter(io.Discard).WriteFileFS(fsys, "file", "missing.txt").Close()
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.ErrorContains(t, err, "missing.txt")
+}
+
+func TestWriter_NewRequest(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	req, err := w.WriteString("string", "text").
+		NewRequest(context.Background(), http.MethodPost, "http://example.com/upload", buf)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, w.FormDataContentType(), req.Header.Get("Content-Type"))
+		if assert.NoError(t, req.ParseMultipartForm(1<<20)) {
+			assert.Equal(t, "text", req.FormValue("string"))
+		}
+	}
+
+	buf = bytes.NewBuffer(nil)
+	w = formy.NewWriter(buf)
+	_, err = w.WriteInt("", 42).
+		NewRequest(context.Background(), http.MethodPost, "http://example.com/upload", buf)
+	assert.Error(t, err)
+}
+
+func TestWriter_WriteJSONRaw(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	raw := []byte(`{"a": [1, 2, 3]}`)
+	err := w.WriteJSONRaw("json", raw).Close()
+
+	if assert.NoError(t, err) {
+		r := multipart.NewReader(buf, w.Boundary())
+		part, err := r.NextPart()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "json", part.FormName())
+			assert.Contains(t, part.Header.Get("Content-Type"), "application/json")
+			b, err := io.ReadAll(part)
+			assert.NoError(t, err)
+			assert.Equal(t, raw, b)
+		}
+	}
+
+	err = formy.NewWriter(io.Discard).WriteJSONRaw("json", []byte(`{"a":`)).Close()
+	assert.Error(t, err)
+}
+
+func TestWriter_WriteJSON(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteJSON("json", map[string]int{"a": 1}).Close()
+
+	if assert.NoError(t, err) {
+		r := multipart.NewReader(buf, w.Boundary())
+		part, err := r.NextPart()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "json", part.FormName())
+			assert.Equal(t, "application/json; charset=utf-8", part.Header.Get("Content-Type"))
+			b, err := io.ReadAll(part)
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"a":1}`, string(b))
+		}
+	}
+}
+
+func TestWriter_TrimJSONNewline(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+	w.TrimJSONNewline(true)
+
+	err := w.WriteJSON("json", map[string]int{"a": 1}).
+		WriteJSONIndent("indent", []int{1}, "", " ").
+		Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 2) {
+			assert.Equal(t, `{"a":1}`, parts[0].body)
+			assert.Equal(t, "[\n 1\n]", parts[1].body)
+		}
+	}
+
+	buf.Reset()
+	w = formy.NewWriter(buf)
+
+	err = w.WriteJSON("json", map[string]int{"a": 1}).Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "{\"a\":1}\n", parts[0].body)
+		}
+	}
+}
+
+func TestWriter_WriteJSONArray(t *testing.T) {
+	const n = 10000
+
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteJSONArray("items", n, func(i int) any {
+		return map[string]int{"id": i}
+	}).WriteJSONArray("empty", 0, func(int) any { return nil }).Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 2) {
+			assert.Equal(t, "application/json; charset=utf-8", parts[0].header.Get("Content-Type"))
+
+			var items []map[string]int
+			if assert.NoError(t, json.Unmarshal([]byte(parts[0].body), &items)) {
+				assert.Len(t, items, n)
+				for i, item := range items {
+					assert.Equal(t, i, item["id"])
+				}
+			}
+			assert.Equal(t, "[]\n", parts[1].body)
+		}
+	}
+
+	var calls int
+	err = formy.NewWriter(io.Discard).WriteJSONArray("items", 10, func(i int) any {
+		calls++
+		if i == 3 {
+			return math.NaN()
+		}
+		return i
+	}).Close()
+	assert.ErrorContains(t, err, "element 3 of field items")
+	assert.Equal(t, 4, calls)
+
+	for trim, want := range map[bool]string{false: "[0,1,\"<b>\"]\n", true: "[0,1,\"<b>\"]"} {
+		buf.Reset()
+		w = formy.NewWriter(buf)
+		w.TrimJSONNewline(trim)
+		err = w.WriteJSONArray("items", 3, func(i int) any {
+			if i == 2 {
+				return "<b>"
+			}
+			return i
+		}).Close()
+		if assert.NoError(t, err) {
+			parts := readParts(t, buf, w.Boundary())
+			if assert.Len(t, parts, 1) {
+				assert.Equal(t, want, parts[0].body)
+			}
+		}
+	}
+}
+
+func TestWriter_WriteJSONIndent(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteJSONIndent("json", map[string]any{"a": []int{1}, "b": "<b>"}, "", "\t").Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "application/json; charset=utf-8", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, "{\n\t\"a\": [\n\t\t1\n\t],\n\t\"b\": \"<b>\"\n}\n", parts[0].body)
+		}
+	}
+
+	err = formy.NewWriter(io.Discard).WriteJSONIndent("json", nil, "", "  ").Close()
+	assert.Error(t, err)
+}
+
+// cancelingReader cancels the context after the first read
+type cancelingReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	defer r.cancel()
+	return r.r.Read(p)
+}
+
+func TestWriter_WriteFileContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := &zeroReader{n: 1 << 20}
+	w := formy.NewWriter(io.Discard)
+	w.DetectContentType(false)
+
+	err := w.WriteFileContext(ctx, "file", "zeros.bin", &cancelingReader{r: src, cancel: cancel}).Close()
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, src.read, src.n)
+
+	err = formy.NewWriter(io.Discard).
+		WriteFileContext(context.Background(), "file", "file.txt", strings.NewReader("TEST")).
+		Close()
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	src = &zeroReader{n: 1 << 20}
+	w = formy.NewWriter(buf)
+	w.CollectAllErrors(true)
+	err = w.WriteFileContext(ctx, "file", "zeros.bin", src).
+		WriteString("name", "alice").
+		Close()
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, src.read)
+	assert.Equal(t, 1, w.PartCount())
+	assert.NotContains(t, buf.String(), "zeros.bin")
+}
+
+func TestWriter_WriteFileProgress(t *testing.T) {
+	const size = 100 * 1024
+	var progress []int64
+
+	err := formy.NewWriter(io.Discard).
+		WriteFileProgress("file", "zeros.bin", &zeroReader{n: size}, func(written int64) {
+			progress = append(progress, written)
+		}).
+		Close()
+
+	if assert.NoError(t, err) && assert.NotEmpty(t, progress) {
+		assert.IsIncreasing(t, progress)
+		assert.Equal(t, int64(size), progress[len(progress)-1])
+	}
+
+	err = formy.NewWriter(io.Discard).
+		WriteFileProgress("file", "file.txt", strings.NewReader("TEST"), nil).
+		Close()
+	assert.NoError(t, err)
+}
+
+func TestWriter_SetMaxFileSize(t *testing.T) {
+	w := formy.NewWriter(io.Discard)
+	w.SetMaxFileSize(1024)
+
+	err := w.WriteFile("small", "small.bin", &zeroReader{n: 1024}).Close()
+	assert.NoError(t, err)
+
+	w = formy.NewWriter(io.Discard)
+	w.SetMaxFileSize(1024)
+
+	err = w.WriteFile("big", "big.bin", &zeroReader{n: 1025}).Close()
+	assert.ErrorIs(t, err, formy.ErrFileTooLarge)
+	assert.ErrorContains(t, err, "big")
+
+	w = formy.NewWriter(io.Discard)
+	w.SetMaxFileSize(10 << 10)
+
+	err = w.WriteReader("big", "big.bin", &zeroReader{n: 1 << 20}, "").Close()
+	assert.ErrorIs(t, err, formy.ErrFileTooLarge)
+}
+
+func TestWriter_SetMaxTotalSize(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteString("string", "text").Close()
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(buf.Len()), w.Written())
+	}
+
+	w = formy.NewWriter(io.Discard)
+	w.SetMaxTotalSize(1024)
+
+	err = w.WriteString("string", "text").
+		WriteFile("file", "zeros.bin", &zeroReader{n: 1024}).
+		WriteString("never", "written").
+		Close()
+	assert.ErrorIs(t, err, formy.ErrBodyTooLarge)
+	assert.LessOrEqual(t, w.Written(), int64(1024))
+
+	w = formy.NewWriter(io.Discard)
+	w.SetMaxTotalSize(1024)
+	w.CollectAllErrors(true)
+
+	err = w.WriteFile("file", "zeros.bin", &zeroReader{n: 1024}).
+		WriteString("never", "written").
+		WriteInt("", 42).
+		WriteString("never", "written").
+		Close()
+	assert.ErrorIs(t, err, formy.ErrBodyTooLarge)
+	assert.Len(t, w.Errors(), 1)
+	assert.Equal(t, 1, w.PartCount())
+}
+
+type testPart struct {
+	name     string
+	filename string
+	header   textproto.MIMEHeader
+	body     string
+}
+
+// readParts reads all parts of body in order
+func readParts(t *testing.T, body io.Reader, boundary string) []testPart {
+	t.Helper()
+
+	var parts []testPart
+	r := multipart.NewReader(body, boundary)
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, testPart{
+			name:     part.FormName(),
+			filename: part.FileName(),
+			header:   part.Header,
+			body:     string(b),
+		})
+	}
+}
+
+func TestWriter_WriteMap(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteMap(map[string]string{"c": "3", "a": "1", "b": "2"}).
+		WriteMapAny(map[string]any{"z": 26, "y": true}).
+		Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.body)
+		}
+		assert.Equal(t, []string{"a=1", "b=2", "c=3", "y=true", "z=26"}, got)
+	}
+}
+
+func TestWriter_WriteValues(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	v := url.Values{
+		"tags":  {"a", "b", "c"},
+		"empty": {""},
+		"id":    {"42"},
+	}
+	err := w.WriteValues(v).Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.body)
+		}
+		assert.Equal(t, []string{"empty=", "id=42", "tags=a", "tags=b", "tags=c"}, got)
+	}
+}
+
+func TestWriter_IfNonZero(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteStringIfNotEmpty("string", "text").
+		WriteStringIfNotEmpty("empty_string", "").
+		WriteBytesIfNotEmpty("empty_bytes", nil).
+		WriteIntIfNonZero("int", 42).
+		WriteIntIfNonZero("zero_int", 0).
+		WriteInt64IfNonZero("zero_int64", 0).
+		WriteUint64IfNonZero("zero_uint64", 0).
+		WriteFloat32IfNonZero("zero_float32", 0).
+		WriteFloat64IfNonZero("float64", 0.5).
+		WriteBoolIfTrue("bool", true).
+		WriteBoolIfTrue("false_bool", false).
+		Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.body)
+		}
+		assert.Equal(t, []string{"string=text", "int=42", "float64=0.5", "bool=true"}, got)
+	}
+}
+
+func TestWriter_NonASCIIFilename(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteFile("file", "résumé.pdf", strings.NewReader("TEST")).
+		WriteFile("plain", "plain.txt", strings.NewReader("TEST")).
+		Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 2) {
+			cd := parts[0].header.Get("Content-Disposition")
+			assert.Contains(t, cd, `filename="résumé.pdf"`)
+			assert.Contains(t, cd, `filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`)
+			assert.Equal(t, "résumé.pdf", parts[0].filename)
+
+			assert.NotContains(t, parts[1].header.Get("Content-Disposition"), "filename*")
+		}
+	}
+}
+
+func TestWriter_HeaderInjection(t *testing.T) {
+	const evil = "foo\r\nX-Evil: 1"
+
+	err := formy.NewWriter(io.Discard).WriteString(evil, "text").Close()
+	assert.ErrorContains(t, err, "control characters")
+
+	err = formy.NewWriter(io.Discard).WriteInt(evil, 42).Close()
+	assert.ErrorContains(t, err, "control characters")
+
+	err = formy.NewWriter(io.Discard).WriteJSON(evil, 42).Close()
+	assert.ErrorContains(t, err, "control characters")
+
+	err = formy.NewWriter(io.Discard).WriteFile(evil, "file.txt", strings.NewReader("TEST")).Close()
+	assert.ErrorContains(t, err, "control characters")
+
+	err = formy.NewWriter(io.Discard).WriteFile("file", evil, strings.NewReader("TEST")).Close()
+	assert.ErrorContains(t, err, "control characters")
+
+	buf := bytes.NewBuffer(nil)
+	err = formy.NewWriter(buf).WriteString(evil, "text").Close()
+	assert.Error(t, err)
+	assert.NotContains(t, buf.String(), "X-Evil")
+}
+
+func TestWriter_WriteFields(t *testing.T) {
+	w := formy.NewWriter(io.Discard)
+	w.CollectAllErrors(true)
+
+	err := w.WriteFields(map[string]string{
+		"ok":       "1",
+		"bad\r\n1": "2",
+		"bad\r\n2": "3",
+	}).Close()
+
+	assert.Error(t, err)
+	if errs := w.Errors(); assert.Len(t, errs, 2) {
+		assert.ErrorContains(t, errs[0], `field "bad\r\n1"`)
+		assert.ErrorContains(t, errs[1], `field "bad\r\n2"`)
+	}
+
+	w = formy.NewWriter(io.Discard)
+	err = w.WriteFields(map[string]string{
+		"bad\r\n1": "2",
+		"bad\r\n2": "3",
+	}).Close()
+	assert.ErrorContains(t, err, `field "bad\r\n1"`)
+	assert.Len(t, w.Errors(), 1)
+}
+
+func TestWriter_SetConcurrencySafeCallbacks(t *testing.T) {
+	w := formy.NewWriter(io.Discard)
+	w.SetConcurrencySafe(true)
+
+	var calls int
+	done := make(chan error)
+	go func() {
+		done <- w.WriteString("name", "alice").
+			WriteFileProgress("file", "zeros.bin", &zeroReader{n: 1 << 20}, func(int64) {
+				calls++
+				_ = w.Written()
+				_ = w.PartCount()
+				_ = w.Errors()
+				_ = w.Closed()
+				_ = w.Err()
+			}).
+			Close()
+	}()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+		assert.Positive(t, calls)
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock in the progress callback")
+	}
+}
+
+func TestWriter_WriteFieldsConcurrent(t *testing.T) {
+	const n = 20
+
+	w := formy.NewWriter(io.Discard)
+	w.SetConcurrencySafe(true)
+	w.CollectAllErrors(true)
+
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := "bad\n" + strconv.Itoa(i)
+			if i%2 == 0 {
+				w.WriteFields(map[string]string{name: "value"})
+			} else {
+				w.WriteString(name, "value")
+			}
+		}()
+	}
+	wg.Wait()
+
+	errs := w.Errors()
+	assert.Len(t, errs, n)
+	tagged := 0
+	for _, err := range errs {
+		if strings.HasPrefix(err.Error(), "field ") {
+			tagged++
+		}
+	}
+	assert.Equal(t, n/2, tagged)
+}
+
+func TestWriter_PartCount(t *testing.T) {
+	w := formy.NewWriter(io.Discard)
+	assert.Equal(t, 0, w.PartCount())
+
+	err := w.WriteString("string", "text").
+		WriteInt("int", 42).
+		WriteIntCond("skipped", 42, func() bool { return false }).
+		WriteJSON("json", []int{1}).
+		WriteFile("file", "file.txt", strings.NewReader("TEST")).
+		WriteStringIfNotEmpty("empty", "").
+		Close()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, w.PartCount())
+}
+
+func TestWriter_WriteBase64(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	data := []byte{0x00, 0xFF, 0x10, 'b', 'i', 'n'}
+	err := w.WriteBase64("file", "data.bin", data).Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "base64", parts[0].header.Get("Content-Transfer-Encoding"))
+			assert.Equal(t, "data.bin", parts[0].filename)
+			decoded, err := base64.StdEncoding.DecodeString(parts[0].body)
+			assert.NoError(t, err)
+			assert.Equal(t, data, decoded)
+		}
+	}
+
+	buf.Reset()
+	w = formy.NewWriter(buf)
+	data = bytes.Repeat([]byte{0x00, 0xFF, 0x10}, 100)
+	err = w.WriteBase64("file", "data.bin", data).Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			lines := strings.Split(parts[0].body, "\r\n")
+			assert.Len(t, lines, 6)
+			for i, line := range lines {
+				if i < len(lines)-1 {
+					assert.Len(t, line, 76)
+				} else {
+					assert.LessOrEqual(t, len(line), 76)
+				}
+			}
+			decoded, err := base64.StdEncoding.DecodeString(parts[0].body)
+			assert.NoError(t, err)
+			assert.Equal(t, data, decoded)
+		}
+	}
+}
+
+func TestWriter_Clone(t *testing.T) {
+	w := formy.NewWriter(io.Discard)
+	w.DetectContentType(false)
+	w.SetMaxFileSize(1024)
+
+	buf := bytes.NewBuffer(nil)
+	c, err := w.Clone(buf)
+	if assert.NoError(t, err) {
+		err = c.WriteFile("file", "file.txt", strings.NewReader("TEST")).Close()
+		if assert.NoError(t, err) {
+			parts := readParts(t, buf, c.Boundary())
+			if assert.Len(t, parts, 1) {
+				assert.Equal(t, "application/octet-stream", parts[0].header.Get("Content-Type"))
+			}
+		}
+
+		c, err = w.Clone(io.Discard)
+		if assert.NoError(t, err) {
+			err = c.WriteFile("file", "zeros.bin", &zeroReader{n: 2048}).Close()
+			assert.ErrorIs(t, err, formy.ErrFileTooLarge)
+		}
+	}
+
+	_, err = w.WriteString("string", "text").Clone(io.Discard)
+	assert.Error(t, err)
+}
+
+type note struct {
+	XMLName xml.Name `xml:"note"`
+	To      string   `xml:"to"`
+	Body    string   `xml:"body"`
+}
+
+func TestWriter_WriteXML(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	want := note{To: "bob", Body: "hi"}
+	err := w.WriteXML("note", want).
+		WriteXMLCond("skipped", want, func() bool { return false }).
+		Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "note", parts[0].name)
+			assert.Equal(t, "application/xml", parts[0].header.Get("Content-Type"))
+			var got note
+			assert.NoError(t, xml.Unmarshal([]byte(parts[0].body), &got))
+			assert.Equal(t, want.To, got.To)
+			assert.Equal(t, want.Body, got.Body)
+		}
+	}
+
+	assert.Error(t, formy.NewWriter(io.Discard).WriteXML("note", nil).Close())
+}
+
+func TestWriter_WriteCSV(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	records := [][]string{
+		{"id", "name"},
+		{"1", "alice"},
+		{"2", "bob, the \"builder\""},
+	}
+	err := w.WriteCSV("table", "table.csv", records).
+		WriteCSV("empty", "empty.csv", nil).
+		Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 2) {
+			assert.Equal(t, "table.csv", parts[0].filename)
+			assert.Equal(t, "text/csv", parts[0].header.Get("Content-Type"))
+			got, err := csv.NewReader(strings.NewReader(parts[0].body)).ReadAll()
+			assert.NoError(t, err)
+			assert.Equal(t, records, got)
+
+			assert.Equal(t, "empty.csv", parts[1].filename)
+			assert.Empty(t, parts[1].body)
+		}
+	}
+}
+
+func TestWriter_SetStrictFieldNames(t *testing.T) {
+	w := formy.NewWriter(io.Discard)
+	err := w.WriteInt("chat_id", 1).WriteInt("chat_id", 2).Close()
+	assert.NoError(t, err)
+
+	w = formy.NewWriter(io.Discard)
+	w.SetStrictFieldNames(true)
+	err = w.WriteInt("chat_id", 1).WriteInt("chat_id", 2).Close()
+	assert.ErrorContains(t, err, "duplicate field name chat_id")
+
+	buf := bytes.NewBuffer(nil)
+	w = formy.NewWriter(buf)
+	w.SetStrictFieldNames(true)
+	w.AllowRepeated("tags")
+	err = formy.WriteSlice(w, "tags", []string{"a", "b"}).
+		WriteInt("chat_id", 1).
+		Close()
+	if assert.NoError(t, err) {
+		assert.Len(t, readParts(t, buf, w.Boundary()), 3)
+	}
+}
+
+func TestWriter_SetFallbackContentType(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+	w.SetFallbackContentType("application/binary")
+
+	err := w.WriteFile("unknown", "zeros.bin", &zeroReader{n: 16}).
+		WriteReader("reader", "reader.bin", strings.NewReader("TEST"), "").
+		WriteFile("text", "file.txt", strings.NewReader("TEST")).
+		Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 3) {
+			assert.Equal(t, "application/binary", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, "application/binary", parts[1].header.Get("Content-Type"))
+			assert.Equal(t, "text/plain; charset=utf-8", parts[2].header.Get("Content-Type"))
+		}
+	}
+
+	w = formy.NewWriter(io.Discard)
+	w.SetFallbackContentType("not a media type")
+	assert.Error(t, w.Close())
+
+	w = formy.NewWriter(io.Discard)
+	w.SetFallbackContentType("application")
+	assert.ErrorContains(t, w.Close(), "missing subtype")
+}
+
+func TestWriter_SetDetectLimit(t *testing.T) {
+	// plain text detection needs the whole peek to be valid text,
+	// so a binary byte after the limit doesn't change the result
+	content := strings.Repeat("a", 100) + "\x00"
+
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+	w.SetDetectLimit(50)
+
+	err := w.WriteFile("short", "file", strings.NewReader(content)).Close()
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "text/plain; charset=utf-8", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, content, parts[0].body)
+		}
+	}
+
+	buf = bytes.NewBuffer(nil)
+	w = formy.NewWriter(buf)
+	w.SetDetectLimit(-1)
+
+	err = w.WriteFile("long", "file", strings.NewReader(content)).Close()
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "application/octet-stream", parts[0].header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestWriter_SetDetector(t *testing.T) {
+	type call struct {
+		peek     string
+		filename string
+	}
+	var calls []call
+
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+	w.SetDetector(func(peek []byte, filename string) string {
+		calls = append(calls, call{string(peek), filename})
+		if strings.HasSuffix(filename, ".custom") {
+			return "application/x-custom"
+		}
+		return ""
+	})
+
+	err := w.WriteFile("custom", "file.custom", strings.NewReader("TEST")).
+		WriteFile("unknown", "file.txt", strings.NewReader("TEST")).
+		Close()
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, []call{{"TEST", "file.custom"}, {"TEST", "file.txt"}}, calls)
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 2) {
+			assert.Equal(t, "application/x-custom", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, "application/octet-stream", parts[1].header.Get("Content-Type"))
+			assert.Equal(t, "TEST", parts[0].body)
+		}
+	}
+
+	for _, ct := range []string{"png", "text/plain\r\nX-Evil: 1"} {
+		buf.Reset()
+		w = formy.NewWriter(buf)
+		w.SetDetector(func([]byte, string) string { return ct })
+		if assert.NoError(t, w.WriteFile("file", "file.png", strings.NewReader("TEST")).Close()) {
+			parts := readParts(t, buf, w.Boundary())
+			if assert.Len(t, parts, 1) {
+				assert.Equal(t, "application/octet-stream", parts[0].header.Get("Content-Type"))
+			}
+		}
+	}
+}
+
+func TestWriter_MustMode(t *testing.T) {
+	w := formy.NewWriter(io.Discard)
+	w.MustMode(true)
+
+	assert.NotPanics(t, func() {
+		w.WriteString("string", "text")
+	})
+	assert.PanicsWithError(t, `formy: field json: empty field value`, func() {
+		w.WriteJSON("json", nil)
+	})
+	assert.NoError(t, w.Close())
+}
+
+func TestWriter_WriteFloat(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+	w.SetRejectNonFinite(false)
+
+	err := w.WriteFloat("money", 12.345, 'f', 2).
+		WriteFloat("big", 1e20, 'f', -1).
+		WriteFloat("exp", 1e20, 'e', -1).
+		WriteFloat("nan", math.NaN(), 'f', -1).
+		WriteFloat("inf", math.Inf(1), 'f', -1).
+		WriteFloat("-inf", math.Inf(-1), 'f', -1).
+		Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.body)
+		}
+		assert.Equal(t, []string{
+			"money=12.35",
+			"big=100000000000000000000",
+			"exp=1e+20",
+			"nan=NaN",
+			"inf=+Inf",
+			"-inf=-Inf",
+		}, got)
+	}
+}
+
+func TestWriter_WriteDuration(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	durations := []time.Duration{0, 1500 * time.Millisecond, time.Hour + 2*time.Minute + 3*time.Second, -time.Nanosecond}
+	for _, d := range durations {
+		w.WriteDuration("d", d)
+	}
+	err := w.WriteDurationCond("skipped", time.Second, func() bool { return false }).Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, len(durations)) {
+			for i, p := range parts {
+				d, err := time.ParseDuration(p.body)
+				assert.NoError(t, err)
+				assert.Equal(t, durations[i], d)
+			}
+		}
+	}
+}
+
+func TestWriter_WriteComplex128(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	values := []complex128{0, complex(1.5, 2), complex(-1e-10, -3), complex(0, 1e20)}
+	for _, c := range values {
+		w.WriteComplex128("c", c)
+	}
+	err := w.WriteComplex128Cond("skipped", 1, func() bool { return false }).Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, len(values)) {
+			assert.Equal(t, "(1.5+2i)", parts[1].body)
+			for i, p := range parts {
+				c, err := strconv.ParseComplex(p.body, 128)
+				assert.NoError(t, err)
+				assert.Equal(t, values[i], c)
+			}
+		}
+	}
+
+	err = formy.NewWriter(io.Discard).WriteComplex128("c", complex(1, math.NaN())).Close()
+	assert.ErrorContains(t, err, "non-finite")
+}
+
+func TestWriter_SetRejectNonFinite(t *testing.T) {
+	for name, write := range map[string]func(w *formy.Writer) *formy.Writer{
+		"WriteFloat64":      func(w *formy.Writer) *formy.Writer { return w.WriteFloat64("f", math.NaN()) },
+		"WriteFloat32":      func(w *formy.Writer) *formy.Writer { return w.WriteFloat32("f", float32(math.Inf(1))) },
+		"WriteFloat":        func(w *formy.Writer) *formy.Writer { return w.WriteFloat("f", math.Inf(-1), 'f', -1) },
+		"WriteAnyTextField": func(w *formy.Writer) *formy.Writer { return w.WriteAnyTextField("f", math.Inf(1)) },
+		"WriteSlice":        func(w *formy.Writer) *formy.Writer { return formy.WriteSlice(w, "f", []float64{math.NaN()}) },
+		"WriteWhen":         func(w *formy.Writer) *formy.Writer { return formy.WriteWhen(w, "f", math.NaN(), true) },
+		"WritePtr": func(w *formy.Writer) *formy.Writer {
+			f := float32(math.NaN())
+			return formy.WritePtr(w, "f", &f)
+		},
+		"WriteMapAny": func(w *formy.Writer) *formy.Writer { return w.WriteMapAny(map[string]any{"f": math.Inf(-1)}) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := write(formy.NewWriter(io.Discard)).Close()
+			assert.ErrorContains(t, err, "non-finite")
+
+			buf := bytes.NewBuffer(nil)
+			w := formy.NewWriter(buf)
+			w.SetRejectNonFinite(false)
+			if assert.NoError(t, write(w).Close()) {
+				parts := readParts(t, buf, w.Boundary())
+				if assert.Len(t, parts, 1) {
+					assert.Contains(t, []string{"NaN", "+Inf", "-Inf"}, parts[0].body)
+				}
+			}
+		})
+	}
+}
+
+func TestWriter_WriteFileFromResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/typed" {
+			w.Header().Set("Content-Type", "audio/ogg")
+		} else {
+			// prevents the server from sniffing the content type
+			w.Header()["Content-Type"] = nil
+		}
+		io.WriteString(w, "PAYLOAD")
+	}))
+	defer srv.Close()
+
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	for _, path := range []string{"/typed", "/untyped"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.WriteFileFromResponse(strings.TrimPrefix(path, "/"), "payload", resp)
+	}
+
+	if assert.NoError(t, w.Close()) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 2) {
+			assert.Equal(t, "audio/ogg", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, "PAYLOAD", parts[0].body)
+			assert.Equal(t, "text/plain; charset=utf-8", parts[1].header.Get("Content-Type"))
+			assert.Equal(t, "PAYLOAD", parts[1].body)
+		}
+	}
+
+	buf.Reset()
+	w = formy.NewWriter(buf)
+	resp := &http.Response{
+		Header: http.Header{"Content-Type": {"text"}},
+		Body:   io.NopCloser(strings.NewReader("%PDF-1.4")),
+	}
+	if assert.NoError(t, w.WriteFileFromResponse("doc", "doc", resp).Close()) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "application/pdf", parts[0].header.Get("Content-Type"))
+		}
+	}
+
+	assert.NotPanics(t, func() {
+		err := formy.NewWriter(io.Discard).WriteFileFromResponse("doc", "doc", &http.Response{}).Close()
+		assert.EqualError(t, err, "nil response body for field doc")
+	})
+}
+
+func TestWriter_CreatePart(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="custom"`},
+		"Content-Type":        {"application/yaml"},
+	})
+	if assert.NoError(t, err) {
+		io.WriteString(part, "a: 1")
+	}
+
+	if assert.NoError(t, w.Close()) {
+		assert.Equal(t, 1, w.PartCount())
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "custom", parts[0].name)
+			assert.Equal(t, "application/yaml", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, "a: 1", parts[0].body)
+		}
+	}
+
+	w = formy.NewWriter(io.Discard)
+	_, err = w.WriteInt("", 42).CreatePart(textproto.MIMEHeader{})
+	assert.EqualError(t, err, "empty field name")
+}
+
+func TestWriter_WriteFileChecksum(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	content := strings.Repeat("TEST", 1000)
+	err := w.WriteFileChecksum("file", "file.txt", strings.NewReader(content), sha256.New(), "X-Checksum-SHA256").
+		WriteFileChecksum("md5", "file.txt", strings.NewReader(content), md5.New(), "content-md5").
+		Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 2) {
+			assert.Equal(t, content, parts[0].body)
+			sha := sha256.Sum256([]byte(parts[0].body))
+			assert.Equal(t, hex.EncodeToString(sha[:]), parts[0].header.Get("X-Checksum-SHA256"))
+
+			md := md5.Sum([]byte(parts[1].body))
+			assert.Equal(t, base64.StdEncoding.EncodeToString(md[:]), parts[1].header.Get("Content-MD5"))
+		}
+	}
+
+	err = formy.NewWriter(io.Discard).WriteFileChecksum("file", "file.txt", strings.NewReader(content), nil, "X-Checksum").Close()
+	assert.Error(t, err)
+
+	w = formy.NewWriter(io.Discard)
+	w.SetMaxFileSize(10)
+	err = w.WriteFileChecksum("file", "file.txt", strings.NewReader(content), sha256.New(), "X-Checksum").Close()
+	assert.ErrorIs(t, err, formy.ErrFileTooLarge)
+}
+
+func TestWriter_Unwrap(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	w.WriteString("formy", "text")
+	assert.NoError(t, w.Unwrap().WriteField("stdlib", "text"))
+
+	if assert.NoError(t, w.Close()) {
+		assert.Equal(t, w.Boundary(), w.Unwrap().Boundary())
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 2) {
+			assert.Equal(t, "formy", parts[0].name)
+			assert.Equal(t, "stdlib", parts[1].name)
+		}
+	}
+}
+
+func TestWriter_CreateFormFile(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+	w.SetFallbackContentType("text/csv")
+
+	part, err := w.CreateFormFile("file", "report.csv")
+	if assert.NoError(t, err) {
+		for i := range 3 {
+			fmt.Fprintf(part, "%d,%d\n", i, i*i)
+		}
+	}
+
+	if assert.NoError(t, w.Close()) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "file", parts[0].name)
+			assert.Equal(t, "report.csv", parts[0].filename)
+			assert.Equal(t, "text/csv", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, "0,0\n1,1\n2,4\n", parts[0].body)
+		}
+	}
+
+	w = formy.NewWriter(io.Discard)
+	_, err = w.CreateFormFile("file", "")
+	assert.Error(t, err)
+	assert.Equal(t, err, w.Err())
+}
+
+func TestWriter_WriteNamedFile(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteNamedFile("report.txt", strings.NewReader("TEST")).Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "report.txt", parts[0].name)
+			assert.Equal(t, "report.txt", parts[0].filename)
+			assert.Equal(t, "TEST", parts[0].body)
+		}
+	}
+}
+
+func TestWriter_WriteFileGzip(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	content := strings.Repeat("compress me ", 1000)
+	err := w.WriteFileGzip("file", "file.txt", strings.NewReader(content)).Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "gzip", parts[0].header.Get("Content-Encoding"))
+			assert.Equal(t, "text/plain; charset=utf-8", parts[0].header.Get("Content-Type"))
+			assert.Less(t, len(parts[0].body), len(content))
+
+			zr, err := gzip.NewReader(strings.NewReader(parts[0].body))
+			if assert.NoError(t, err) {
+				b, err := io.ReadAll(zr)
+				assert.NoError(t, err)
+				assert.Equal(t, content, string(b))
+			}
+		}
+	}
+}
+
+func TestWriter_ContentLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("TEST"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteFilePath("path", path).
+		WriteFileFS(fstest.MapFS{"file.txt": {Data: []byte("TEST!")}}, "fs", "file.txt").
+		WriteSizedReader("sized", "sized.txt", strings.NewReader("TEST"), 4).
+		WriteSizedReader("unknown", "unknown.txt", strings.NewReader("TEST"), -1).
+		WriteFile("plain", "plain.txt", strings.NewReader("TEST")).
+		Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.header.Get("Content-Length"))
+		}
+		assert.Equal(t, []string{"path=4", "fs=5", "sized=4", "unknown=", "plain="}, got)
+	}
+
+	err = formy.NewWriter(io.Discard).WriteSizedReader("sized", "sized.txt", strings.NewReader("TEST"), 3).Close()
+	assert.ErrorContains(t, err, "larger than 3 bytes")
+
+	err = formy.NewWriter(io.Discard).WriteSizedReader("sized", "sized.txt", strings.NewReader("TEST"), 5).Close()
+	assert.ErrorContains(t, err, "smaller than 5 bytes")
+}
+
+func TestWriter_WriteFileRange(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	src := []byte("%PDF-1.4 0123456789")
+	err := w.WriteFileRange("head", "head.pdf", bytes.NewReader(src), 0, 8).
+		WriteFileRange("tail", "tail.bin", bytes.NewReader(src), 9, 10).
+		WriteFileRange("empty", "empty.bin", bytes.NewReader(src), 19, 0).
+		Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 3) {
+			assert.Equal(t, "%PDF-1.4", parts[0].body)
+			assert.Equal(t, "application/pdf", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, "8", parts[0].header.Get("Content-Length"))
+			assert.Equal(t, "0123456789", parts[1].body)
+			assert.Equal(t, "", parts[2].body)
+		}
+	}
+
+	err = formy.NewWriter(io.Discard).WriteFileRange("file", "file.bin", bytes.NewReader(src), 10, 10).Close()
+	assert.ErrorContains(t, err, "exceeds the source")
+
+	// a source without Size is checked while copying
+	section := struct{ io.ReaderAt }{bytes.NewReader(src)}
+	err = formy.NewWriter(io.Discard).WriteFileRange("file", "file.bin", section, 10, 10).Close()
+	assert.ErrorContains(t, err, "smaller than 10 bytes")
+
+	err = formy.NewWriter(io.Discard).WriteFileRange("file", "file.bin", bytes.NewReader(src), -1, 10).Close()
+	assert.ErrorContains(t, err, "invalid range")
+
+	err = formy.NewWriter(io.Discard).WriteFileRange("file", "file.bin", nil, 0, 10).Close()
+	assert.Error(t, err)
+}
+
+func TestWritePtr(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	str, i := "text", 42
+	var nilStr *string
+	var nilInt *int
+
+	formy.WritePtr(w, "string", &str)
+	formy.WritePtr(w, "int", &i)
+	formy.WritePtr(w, "nil_string", nilStr)
+	formy.WritePtr(w, "nil_int", nilInt)
+
+	if assert.NoError(t, w.Close()) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.body)
+		}
+		assert.Equal(t, []string{"string=text", "int=42"}, got)
+	}
+}
+
+func TestWriteWhen(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	w.WriteStringWhen("string", "text", true).
+		WriteStringWhen("skipped_string", "text", false)
+	formy.WriteWhen(w, "int", 42, true)
+	formy.WriteWhen(w, "skipped_int", 42, false)
+
+	if assert.NoError(t, w.Close()) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.body)
+		}
+		assert.Equal(t, []string{"string=text", "int=42"}, got)
+	}
+}
+
+func TestNewValidator(t *testing.T) {
+	v := formy.NewValidator()
+	err := v.WriteString("string", "text").
+		WriteJSON("json", map[string]int{"a": 1}).
+		WriteFile("file", "file.txt", strings.NewReader("TEST")).
+		Close()
+	assert.NoError(t, err)
+
+	v = formy.NewValidator(formy.WithCollectAllErrors(true))
+	err = v.WriteJSON("json", make(chan int)).
+		WriteFilePath("file", filepath.Join(t.TempDir(), "missing.txt")).
+		Close()
+	assert.Error(t, err)
+	assert.Len(t, v.Errors(), 2)
+}
+
+func TestWriter_SetConcurrencySafe(t *testing.T) {
+	const n = 50
+
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+	w.SetConcurrencySafe(true)
+
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := strconv.Itoa(i)
+			if i%2 == 0 {
+				w.WriteString(name, strings.Repeat(name, 100))
+			} else {
+				w.WriteFile(name, name+".txt", strings.NewReader(strings.Repeat(name, 10000)))
+			}
+			_ = w.PartCount()
+			_ = w.Err()
+		}()
+	}
+	wg.Wait()
+
+	if assert.NoError(t, w.Close()) {
+		parts := readParts(t, buf, w.Boundary())
+		assert.Len(t, parts, n)
+		for _, p := range parts {
+			i, err := strconv.Atoi(p.name)
+			if assert.NoError(t, err) {
+				count := 100
+				if i%2 != 0 {
+					count = 10000
+				}
+				assert.Equal(t, strings.Repeat(p.name, count), p.body)
+			}
+		}
+	}
+}
+
+func TestBuildBytes(t *testing.T) {
+	body, contentType, err := formy.BuildBytes(func(w *formy.Writer) {
+		w.WriteString("a", "1")
+	})
+	if assert.NoError(t, err) {
+		_, params, err := mime.ParseMediaType(contentType)
+		if assert.NoError(t, err) {
+			parts := readParts(t, bytes.NewReader(body), params["boundary"])
+			if assert.Len(t, parts, 1) {
+				assert.Equal(t, "1", parts[0].body)
+			}
+		}
+	}
+
+	body, contentType, err = formy.BuildBytes(func(w *formy.Writer) {
+		w.WriteString("", "1")
+	})
+	assert.Error(t, err)
+	assert.Nil(t, body)
+	assert.Empty(t, contentType)
+}
+
+// closeTracker records whether it was closed, and returns err from Close
+type closeTracker struct {
+	io.Reader
+	closed bool
+	err    error
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return c.err
+}
+
+func TestWriter_WriteFileLazy(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	var opened []string
+	var files []*closeTracker
+	open := func(content string) func() (io.ReadCloser, error) {
+		return func() (io.ReadCloser, error) {
+			opened = append(opened, content)
+			f := &closeTracker{Reader: strings.NewReader(content)}
+			files = append(files, f)
+			return f, nil
+		}
+	}
+
+	w.WriteFileLazy("first", "first.txt", open("FIRST")).
+		WriteString("eager", "text").
+		WriteFileLazy("second", "second.txt", open("SECOND"))
+	assert.Empty(t, opened)
+
+	if assert.NoError(t, w.Close()) {
+		assert.Equal(t, []string{"FIRST", "SECOND"}, opened)
+		for _, f := range files {
+			assert.True(t, f.closed)
+		}
+
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.body)
+		}
+		assert.Equal(t, []string{"eager=text", "first=FIRST", "second=SECOND"}, got)
+	}
+
+	w = formy.NewWriter(io.Discard)
+	w.WriteFileLazy("file", "file.txt", func() (io.ReadCloser, error) {
+		return nil, os.ErrNotExist
+	})
+	assert.NoError(t, w.Err())
+	assert.ErrorIs(t, w.Close(), os.ErrNotExist)
+
+	err := formy.NewWriter(io.Discard).WriteFileLazy("", "file.txt", open("")).Err()
+	assert.Error(t, err)
+}
+
+func TestWriter_SetTextCharset(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	w.WriteString("before", "text")
+	w.SetTextCharset("utf-8")
+	w.WriteString("string", "text").
+		WriteInt("int", 42).
+		WriteJSON("json", 42)
+	w.SetTextCharset("")
+	w.WriteString("after", "text")
+
+	if assert.NoError(t, w.Close()) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.header.Get("Content-Type"))
+		}
+		assert.Equal(t, []string{
+			"before=",
+			"string=text/plain; charset=utf-8",
+			"int=text/plain; charset=utf-8",
+			"json=application/json; charset=utf-8",
+			"after=",
+		}, got)
+	}
+
+	w = formy.NewWriter(io.Discard)
+	w.SetTextCharset("utf 8;")
+	assert.Error(t, w.Err())
+}
+
+func TestWriter_SetFieldNameFunc(t *testing.T) {
+	snakeCase := func(s string) string {
+		var b strings.Builder
+		for i, r := range s {
+			if unicode.IsUpper(r) {
+				if i > 0 {
+					b.WriteByte('_')
+				}
+				r = unicode.ToLower(r)
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+	w.SetFieldNameFunc(snakeCase)
+
+	err := w.WriteString("UserName", "alice").
+		WriteInt("UserAge", 30).
+		WriteJSON("UserTags", []string{"a"}).
+		WriteFile("AvatarFile", "avatar.txt", strings.NewReader("TEST")).
+		WriteFileLazy("LazyFile", "lazy.txt", func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("TEST")), nil
+		}).
+		Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name)
+		}
+		assert.Equal(t, []string{"user_name", "user_age", "user_tags", "avatar_file", "lazy_file"}, got)
+	}
+
+	w = formy.NewWriter(io.Discard)
+	w.SetFieldNameFunc(func(string) string { return "" })
+	assert.EqualError(t, w.WriteString("name", "alice").Err(), "empty field name")
+}
+
+func TestEstimateSize(t *testing.T) {
+	build := func(w *formy.Writer) {
+		w.WriteString("name", "alice").
+			WriteJSON("json", map[string]int{"a": 1}).
+			WriteFile("file", "файл.txt", strings.NewReader(strings.Repeat("TEST", 10000))).
+			WriteFileLazy("lazy", "lazy.txt", func() (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader("LAZY")), nil
+			})
+	}
+
+	size, err := formy.EstimateSize(build)
+	if assert.NoError(t, err) {
+		buf := bytes.NewBuffer(nil)
+		w := formy.NewWriter(buf)
+		build(w)
+		if assert.NoError(t, w.Close()) {
+			assert.Equal(t, int64(buf.Len()), size)
+		}
+	}
+
+	_, err = formy.EstimateSize(func(w *formy.Writer) {
+		w.WriteString("", "alice")
+	})
+	assert.Error(t, err)
+}
+
+func TestGenerateBoundary(t *testing.T) {
+	boundary, err := formy.GenerateBoundary(20, "")
+	if assert.NoError(t, err) {
+		assert.Len(t, boundary, 20)
+		assert.Regexp(t, `^[0-9A-Za-z]+$`, boundary)
+
+		w := formy.NewWriterWith(io.Discard, formy.WithBoundary(boundary))
+		assert.NoError(t, w.Close())
+		assert.Equal(t, boundary, w.Boundary())
+	}
+
+	boundary, err = formy.GenerateBoundary(70, "ab'()+_,-./:=?")
+	if assert.NoError(t, err) {
+		assert.Len(t, boundary, 70)
+		assert.NoError(t, multipart.NewWriter(io.Discard).SetBoundary(boundary))
+	}
+
+	for _, tc := range []struct {
+		length   int
+		alphabet string
+	}{
+		{0, ""},
+		{71, ""},
+		{10, "ab;"},
+		{10, "ab "},
+		{10, "абв"},
+	} {
+		_, err := formy.GenerateBoundary(tc.length, tc.alphabet)
+		assert.Error(t, err, "length %d, alphabet %q", tc.length, tc.alphabet)
+	}
+}
+
+func TestWriter_WriteAnyTextFieldCond(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	var calls int
+	counting := func(result bool) formy.Condition {
+		return func() bool {
+			calls++
+			return result
+		}
+	}
+
+	w.WriteAnyTextFieldCond("written", 42, counting(true))
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	w.WriteAnyTextFieldCond("skipped", 42, counting(false))
+	assert.Equal(t, 1, calls)
+
+	if assert.NoError(t, w.Close()) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "written", parts[0].name)
+			assert.Equal(t, "42", parts[0].body)
+		}
+	}
+}
+
+func TestWriter_WriteFiles(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteFiles("files[]", map[string]io.Reader{
+		"b.pdf": strings.NewReader("%PDF-1.4"),
+		"a.txt": strings.NewReader("TEXT"),
+		"c.bin": bytes.NewReader([]byte{0, 1, 2}),
+	}).Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+" "+p.filename+" "+p.header.Get("Content-Type")+" "+p.body)
+		}
+		assert.Equal(t, []string{
+			"files[] a.txt text/plain; charset=utf-8 TEXT",
+			"files[] b.pdf application/pdf %PDF-1.4",
+			"files[] c.bin application/octet-stream \x00\x01\x02",
+		}, got)
+	}
+
+	var read bool
+	err = formy.NewWriter(io.Discard).WriteFiles("files", map[string]io.Reader{
+		"a.txt": nil,
+		"b.txt": readerFunc(func(p []byte) (int, error) {
+			read = true
+			return 0, io.EOF
+		}),
+	}).Close()
+	assert.Error(t, err)
+	assert.False(t, read)
+}
+
+// readerFunc implements io.Reader with a function
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// binaryMarshaler implements encoding.BinaryMarshaler returning data or err
+type binaryMarshaler struct {
+	data []byte
+	err  error
+}
+
+func (m binaryMarshaler) MarshalBinary() ([]byte, error) {
+	return m.data, m.err
+}
+
+func TestWriter_WriteMarshalerFile(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteMarshalerFile("report", "report.pdf", binaryMarshaler{data: []byte("%PDF-1.4")}).
+		WriteMarshalerFile("time", "time.bin", time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)).
+		Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 2) {
+			assert.Equal(t, "report.pdf", parts[0].filename)
+			assert.Equal(t, "application/pdf", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, "%PDF-1.4", parts[0].body)
+
+			var tm time.Time
+			assert.NoError(t, tm.UnmarshalBinary([]byte(parts[1].body)))
+			assert.True(t, tm.Equal(time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)))
+		}
+	}
+
+	errMarshal := errors.New("marshal error")
+	err = formy.NewWriter(io.Discard).WriteMarshalerFile("file", "file.bin", binaryMarshaler{err: errMarshal}).Close()
+	assert.ErrorIs(t, err, errMarshal)
+
+	err = formy.NewWriter(io.Discard).WriteMarshalerFile("file", "file.bin", nil).Close()
+	assert.Error(t, err)
+
+	var m *binaryMarshaler
+	assert.NotPanics(t, func() {
+		err = formy.NewWriter(io.Discard).WriteMarshalerFile("file", "file.bin", m).Close()
+	})
+	assert.EqualError(t, err, "nil encoding.BinaryMarshaler for field file")
+}
+
+func TestWriter_Flush(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	lazy := func(content string) func() (io.ReadCloser, error) {
+		return func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(content)), nil
+		}
+	}
+
+	w.WriteFileLazy("first", "first.txt", lazy("FIRST")).
+		WriteString("eager", "text")
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, 2, w.PartCount())
+	assert.NotContains(t, buf.String(), w.Boundary()+"--")
+
+	w.WriteFileLazy("second", "second.txt", lazy("SECOND")).
+		WriteString("after", "text")
+	assert.NoError(t, w.Flush())
+	assert.NoError(t, w.Flush())
+
+	if assert.NoError(t, w.Close()) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name)
+		}
+		assert.Equal(t, []string{"eager", "first", "after", "second"}, got)
+	}
+
+	w = formy.NewWriter(io.Discard)
+	w.WriteFileLazy("file", "file.txt", func() (io.ReadCloser, error) {
+		return nil, os.ErrNotExist
+	})
+	assert.ErrorIs(t, w.Flush(), os.ErrNotExist)
+	assert.ErrorIs(t, w.WriteString("after", "text").Err(), os.ErrNotExist)
+}
+
+func BenchmarkWriter_WriteFile(b *testing.B) {
+	data := bytes.Repeat([]byte("TEST"), 1<<18)
+
+	b.Run("stream", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			w := formy.NewWriter(io.Discard)
+			if err := w.WriteFile("file", "file.txt", bytes.NewReader(data)).Close(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("read_all", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			w := formy.NewWriter(io.Discard)
+			content, err := io.ReadAll(bytes.NewReader(data))
+			if err != nil {
+				b.Fatal(err)
+			}
+			part, err := w.CreateFormFile("file", "file.txt")
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := part.Write(content); err != nil {
+				b.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestWriter_WriteJSONFile(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteJSONFile("metadata", "metadata.json", map[string]string{"title": "<report>"}).Close()
+
+	if assert.NoError(t, err) {
+		r := multipart.NewReader(buf, w.Boundary())
+		part, err := r.NextPart()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "metadata", part.FormName())
+			assert.Equal(t, "metadata.json", part.FileName())
+			assert.Equal(t, "application/json", part.Header.Get("Content-Type"))
+			b, err := io.ReadAll(part)
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"title":"<report>"}`, string(b))
+		}
+	}
+
+	err = formy.NewWriter(io.Discard).WriteJSONFile("metadata", "", 42).Close()
+	assert.Error(t, err)
+
+	err = formy.NewWriter(io.Discard).WriteJSONFile("metadata", "metadata.json", make(chan int)).Close()
+	assert.Error(t, err)
+}
+
+func TestWriter_WriteFileWithContentID(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+	w.SetSubtype("related")
+
+	err := w.WriteFileWithContentID("image", "image.png", "image1@example.com", strings.NewReader("\x89PNG\r\n\x1a\n")).
+		WriteFileWithContentID("doc", "doc.txt", "<doc@example.com>", strings.NewReader("TEXT")).
+		Close()
+
+	if assert.NoError(t, err) {
+		mt, params, err := mime.ParseMediaType(w.FormDataContentType())
+		if assert.NoError(t, err) {
+			assert.Equal(t, "multipart/related", mt)
+			assert.Equal(t, w.Boundary(), params["boundary"])
+		}
+
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 2) {
+			assert.Equal(t, "<image1@example.com>", parts[0].header.Get("Content-ID"))
+			assert.Equal(t, "image/png", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, "<doc@example.com>", parts[1].header.Get("Content-ID"))
+		}
+	}
+
+	for _, id := range []string{"", "<>", "a b", "a\r\nb", "<<a>>"} {
+		err := formy.NewWriter(io.Discard).WriteFileWithContentID("file", "file.txt", id, strings.NewReader("TEXT")).Close()
+		assert.Error(t, err, id)
+	}
+
+	w = formy.NewWriter(io.Discard)
+	w.SetSubtype("related; type=x")
+	assert.Error(t, w.Err())
+	assert.True(t, strings.HasPrefix(w.FormDataContentType(), "multipart/form-data;"))
+}
+
+func TestWriter_Closed(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	w.WriteString("name", "alice")
+	assert.False(t, w.Closed())
+
+	ct, err := w.CloseAndType()
+	if assert.NoError(t, err) {
+		assert.True(t, w.Closed())
+		assert.Equal(t, w.FormDataContentType(), ct)
+
+		// closing again doesn't write the closing boundary twice
+		n := buf.Len()
+		assert.NoError(t, w.Close())
+		assert.Equal(t, n, buf.Len())
+		assert.Len(t, readParts(t, buf, w.Boundary()), 1)
+	}
+
+	_, err = formy.NewWriter(io.Discard).WriteString("", "alice").CloseAndType()
+	assert.Error(t, err)
+}
+
+func TestWriter_WriteAfterClose(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	assert.NoError(t, w.WriteString("a", "b").Close())
+	n := buf.Len()
+
+	err := w.WriteString("after", "close").Close()
+	assert.EqualError(t, err, "field after written after Close")
+	assert.Equal(t, 1, w.PartCount())
+	assert.Equal(t, n, buf.Len())
+
+	w = formy.NewWriter(io.Discard)
+	assert.NoError(t, w.Close())
+	opened := false
+	err = w.WriteFileLazy("file", "file.txt", func() (io.ReadCloser, error) {
+		opened = true
+		return io.NopCloser(strings.NewReader("TEXT")), nil
+	}).Close()
+	assert.EqualError(t, err, "1 deferred fields written after Close")
+	assert.False(t, opened)
+}
+
+func TestWriter_SetStrict(t *testing.T) {
+	w := formy.NewWriter(io.Discard)
+	w.SetStrict(true)
+
+	w.WriteString("name", "alice")
+	w.FormDataContentType()
+	assert.EqualError(t, w.Close(), "FormDataContentType called before Close")
+	assert.False(t, w.Closed())
+
+	w = formy.NewWriter(io.Discard)
+	w.SetStrict(true)
+	w.Boundary()
+	assert.EqualError(t, w.Err(), "Boundary called before Close")
+
+	w = formy.NewWriter(io.Discard)
+	w.SetStrict(true)
+	ct, err := w.WriteString("name", "alice").CloseAndType()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ct)
+	w.Boundary()
+	assert.NoError(t, w.Err())
+}
+
+func TestWriter_WriteFileClose(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	f := &closeTracker{Reader: strings.NewReader("TEST")}
+	err := w.WriteFileClose("file", "file.txt", f).Close()
+	if assert.NoError(t, err) {
+		assert.True(t, f.closed)
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "TEST", parts[0].body)
+		}
+	}
+
+	errRead, errClose := errors.New("read error"), errors.New("close error")
+
+	f = &closeTracker{Reader: iotest.ErrReader(errRead), err: errClose}
+	w = formy.NewWriter(io.Discard)
+	w.DetectContentType(false)
+	err = w.WriteFileClose("file", "file.txt", f).Close()
+	assert.True(t, f.closed)
+	assert.ErrorIs(t, err, errRead)
+	assert.ErrorIs(t, err, errClose)
+
+	f = &closeTracker{Reader: strings.NewReader("TEST")}
+	err = formy.NewWriter(io.Discard).WriteFileClose("", "file.txt", f).Close()
+	assert.True(t, f.closed)
+	assert.Error(t, err)
+
+	f = &closeTracker{Reader: strings.NewReader("TEST")}
+	err = formy.NewWriter(io.Discard).WriteString("", "text").WriteFileClose("file", "file.txt", f).Close()
+	assert.True(t, f.closed)
+	assert.Error(t, err)
+
+	f = &closeTracker{Reader: strings.NewReader("TEST")}
+	w = formy.NewWriter(io.Discard)
+	w.MustMode(true)
+	assert.Panics(t, func() { w.WriteFileClose("file", "", f) })
+	assert.True(t, f.closed)
+}
+
+func TestWriter_WriteEnum(t *testing.T) {
+	modes := []string{"HTML", "Markdown", "MarkdownV2"}
+
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteEnum("parse_mode", "MarkdownV2", modes...).
+		WriteEnumCond("skipped", "Invalid", func() bool { return false }, modes...).
+		WriteEnumCond("written", "HTML", func() bool { return true }, modes...).
+		Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.body)
+		}
+		assert.Equal(t, []string{"parse_mode=MarkdownV2", "written=HTML"}, got)
+	}
+
+	err = formy.NewWriter(io.Discard).WriteEnum("parse_mode", "markdown", modes...).Close()
+	assert.EqualError(t, err, `invalid value "markdown" for field parse_mode, must be one of: HTML, Markdown, MarkdownV2`)
+
+	err = formy.NewWriter(io.Discard).WriteEnumCond("parse_mode", "markdown", func() bool { return true }, modes...).Close()
+	assert.Error(t, err)
+
+	buf.Reset()
+	w = formy.NewWriter(buf)
+	w.SetFieldNameFunc(strings.ToUpper)
+	err = w.WriteEnum("mode", "HTML", modes...).WriteEnum("mode", "markdown", modes...).Close()
+	assert.EqualError(t, err, `invalid value "markdown" for field MODE, must be one of: HTML, Markdown, MarkdownV2`)
+	assert.Equal(t, 1, w.PartCount())
+}
+
+func TestWriter_WriteFileDisposition(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteFileDisposition("inline", "image.png", "inline", strings.NewReader("\x89PNG\r\n\x1a\n")).
+		WriteFileDisposition("attachment", "отчёт.txt", "Attachment", strings.NewReader("TEXT")).
+		WriteFileDisposition("form", "form.txt", "form-data", strings.NewReader("TEXT")).
+		Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.header.Get("Content-Disposition"))
+		}
+		assert.Equal(t, []string{
+			`inline; name="inline"; filename="image.png"`,
+			`attachment; name="attachment"; filename="отчёт.txt"; filename*=UTF-8''%D0%BE%D1%82%D1%87%D1%91%D1%82.txt`,
+			`form-data; name="form"; filename="form.txt"`,
+		}, got)
+	}
+
+	err = formy.NewWriter(io.Discard).WriteFileDisposition("file", "file.txt", "inline; x=y", strings.NewReader("TEXT")).Close()
+	assert.Error(t, err)
+}
+
+func TestWriter_WriteIntSlice(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteIntSlice("ints", []int{3, 1, 2}).
+		WriteFloat64Slice("floats", []float64{0.5, -1, 2.25}).
+		WriteIntSlice("empty", nil).
+		WriteFloat64Slice("empty", []float64{}).
+		WriteIntSliceCond("skipped", []int{1}, func() bool { return false }).
+		WriteFloat64SliceCond("skipped", []float64{1}, func() bool { return false }).
+		WriteIntSliceCond("cond", []int{7}, func() bool { return true }).
+		Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.body)
+		}
+		assert.Equal(t, []string{
+			"ints=3", "ints=1", "ints=2",
+			"floats=0.5", "floats=-1", "floats=2.25",
+			"cond=7",
+		}, got)
+	}
+
+	err = formy.NewWriter(io.Discard).WriteFloat64Slice("floats", []float64{1, math.NaN()}).Close()
+	assert.Error(t, err)
+}
+
+func TestWriter_SetMaxParts(t *testing.T) {
+	const n = 3
+
+	w := formy.NewWriter(io.Discard)
+	w.SetMaxParts(n)
+
+	for i := range n {
+		w.WriteInt("field"+strconv.Itoa(i), i)
+	}
+	assert.NoError(t, w.Err())
+	assert.Equal(t, n, w.PartCount())
+
+	w.WriteFile("extra", "extra.txt", strings.NewReader("TEST"))
+	assert.EqualError(t, w.Close(), "field extra exceeds the limit of 3 parts")
+	assert.Equal(t, n, w.PartCount())
+
+	w = formy.NewWriterWith(io.Discard, formy.WithMaxParts(0))
+	for i := range 100 {
+		w.WriteInt("field", i)
+	}
+	assert.NoError(t, w.Close())
+}
+
+func TestWriter_WriteRune(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteRune("ascii", 'a').
+		WriteRune("euro", '€').
+		WriteRune("emoji", '🙂').
+		WriteByteField("byte", 'x').
+		WriteByteField("binary", 0xff).
+		Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 5) {
+			assert.Equal(t, "a", parts[0].body)
+			assert.Equal(t, "€", parts[1].body)
+			assert.Len(t, parts[1].body, 3)
+			r, _ := utf8.DecodeRuneInString(parts[2].body)
+			assert.Equal(t, '🙂', r)
+			assert.Equal(t, "x", parts[3].body)
+			assert.Equal(t, []byte{0xff}, []byte(parts[4].body))
+		}
+	}
+
+	err = formy.NewWriter(io.Discard).WriteRune("invalid", 0xD800).Close()
+	assert.Error(t, err)
+}
+
+func TestWriter_WriteJSONCond(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteJSONCond("", 42, func() bool { return false }).
+		WriteJSONCond("json", map[string]int{"a": 1}, func() bool { return true }).
+		Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "json", parts[0].name)
+			assert.JSONEq(t, `{"a":1}`, parts[0].body)
+		}
+	}
+
+	err = formy.NewWriter(io.Discard).WriteJSONCond("", 42, func() bool { return true }).Close()
+	assert.EqualError(t, err, "empty field name")
+}
+
+func TestWriter_SetExtensionFallback(t *testing.T) {
+	// the system MIME tables may not know about .csv
+	assert.NoError(t, mime.AddExtensionType(".csv", "text/csv"))
+
+	// the NUL byte makes the content sniff as binary
+	content := "id,name\n1,\x00\n"
+
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+	w.SetExtensionFallback(true)
+
+	err := w.WriteFile("csv", "data.csv", strings.NewReader(content)).
+		WriteFile("unknown", "data.unknown-ext", strings.NewReader(content)).
+		WriteFile("detected", "data.csv", strings.NewReader("%PDF-1.4")).
+		Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.header.Get("Content-Type"))
+		}
+		assert.Equal(t, []string{"text/csv; charset=utf-8", "application/octet-stream", "application/pdf"}, got)
+	}
+
+	buf.Reset()
+	w = formy.NewWriter(buf)
+	err = w.WriteFile("csv", "data.csv", strings.NewReader(content)).Close()
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "application/octet-stream", parts[0].header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestWriter_WriteAnyTextFieldBytes(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	w.WriteAnyTextField("bytes", []byte("hi")).
+		WriteAnyTextField("raw", json.RawMessage(`{"a":1}`)).
+		WriteAnyTextField("ints", []int{1, 2})
+	formy.WriteSlice(w, "slice", [][]byte{[]byte("a"), []byte("b")})
+
+	if assert.NoError(t, w.Close()) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.body)
+		}
+		assert.Equal(t, []string{"bytes=hi", `raw={"a":1}`, "ints=[1 2]", "slice=a", "slice=b"}, got)
+	}
+}
+
+func TestWriter_WriteFileWithModTime(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	modTime := time.Date(1997, time.February, 12, 16, 29, 51, 0, time.FixedZone("EST", -5*60*60))
+	err := w.WriteFileWithModTime("file", "file.txt", modTime, strings.NewReader("TEST")).Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "file.txt", parts[0].filename)
+
+			_, params, err := mime.ParseMediaType(parts[0].header.Get("Content-Disposition"))
+			if assert.NoError(t, err) {
+				assert.Equal(t, "Wed, 12 Feb 1997 16:29:51 -0500", params["modification-date"])
+				got, err := time.Parse(time.RFC1123Z, params["modification-date"])
+				assert.NoError(t, err)
+				assert.True(t, modTime.Equal(got))
+			}
+		}
+	}
+
+	err = formy.NewWriter(io.Discard).WriteFileWithModTime("file", "file.txt", time.Time{}, strings.NewReader("TEST")).Close()
+	assert.Error(t, err)
+}
+
+func TestWriter_WriteTypedField(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	config := "name: alice\ntags:\n  - a\n  - b\n"
+	err := w.WriteTypedField("config", "application/yaml", config).Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "config", parts[0].name)
+			assert.Empty(t, parts[0].filename)
+			assert.Equal(t, "application/yaml", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, config, parts[0].body)
+		}
+	}
+
+	err = formy.NewWriter(io.Discard).WriteTypedField("config", "yaml", config).Close()
+	assert.ErrorContains(t, err, "invalid content type")
+}
+
+func TestWriter_WriteTemplate(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	tmpl := template.Must(template.New("message").Parse("Hello, {{.Name}}! You have {{len .Items}} new items."))
+	err := w.WriteTemplate("message", tmpl, map[string]any{
+		"Name":  "alice",
+		"Items": []int{1, 2, 3},
+	}).Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "message", parts[0].name)
+			assert.Equal(t, "Hello, alice! You have 3 new items.", parts[0].body)
+		}
+	}
+
+	tmpl = template.Must(template.New("message").Parse("{{.Missing.Field}}"))
+	err = formy.NewWriter(io.Discard).WriteTemplate("message", tmpl, struct{}{}).Close()
+	assert.Error(t, err)
+
+	err = formy.NewWriter(io.Discard).WriteTemplate("message", nil, nil).Close()
+	assert.Error(t, err)
+}
+
+func TestWriter_WriteFileNoName(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteFileNoName("doc", strings.NewReader("%PDF-1.4")).Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, `form-data; name="doc"`, parts[0].header.Get("Content-Disposition"))
+			assert.Empty(t, parts[0].filename)
+			assert.Equal(t, "application/pdf", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, "%PDF-1.4", parts[0].body)
+		}
+	}
+
+	err = formy.NewWriter(io.Discard).WriteFileNoName("doc", nil).Close()
+	assert.Error(t, err)
+}
+
+func TestWriter_SetPartHook(t *testing.T) {
+	w := formy.NewWriter(io.Discard)
+
+	var got []string
+	w.SetPartHook(func(name, filename, contentType string, size int64) {
+		got = append(got, fmt.Sprintf("%s|%s|%s|%d", name, filename, contentType, size))
+	})
+
+	w.WriteString("name", "alice").
+		WriteJSON("json", map[string]int{"a": 1}).
+		WriteFile("file", "файл.pdf", strings.NewReader("%PDF-1.4")).
+		WriteFileGzip("gzip", "data.txt", strings.NewReader("TEST")).
+		WriteString("", "invalid")
+	assert.Error(t, w.Close())
+
+	assert.Len(t, got, 4)
+	assert.Equal(t, []string{
+		"name|||5",
+		"json||application/json; charset=utf-8|8",
+		"file|файл.pdf|application/pdf|8",
+	}, got[:3])
+	assert.True(t, strings.HasPrefix(got[3], "gzip|data.txt|text/plain; charset=utf-8|"))
+
+	got = nil
+	w = formy.NewWriter(io.Discard)
+	w.SetPartHook(nil)
+	assert.NoError(t, w.WriteString("name", "alice").Close())
+	assert.Empty(t, got)
+}
+
+func TestWriter_WriteFileChunk(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	content := "0123456789"
+	err := w.WriteFileChunk("chunk", "file.txt", strings.NewReader(content[:4]), 0, 3, 10).
+		WriteFileChunk("chunk", "file.txt", strings.NewReader(content[4:]), 4, 9, 10).
+		Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.header.Get("Content-Range")+" "+p.header.Get("Content-Length")+" "+p.body)
+		}
+		assert.Equal(t, []string{"bytes 0-3/10 4 0123", "bytes 4-9/10 6 456789"}, got)
+	}
+
+	for _, r := range [][3]int64{{-1, 3, 10}, {4, 3, 10}, {0, 10, 10}} {
+		err := formy.NewWriter(io.Discard).WriteFileChunk("chunk", "file.txt", strings.NewReader("0123"), r[0], r[1], r[2]).Close()
+		assert.ErrorContains(t, err, "invalid range", r)
+	}
+
+	err = formy.NewWriter(io.Discard).WriteFileChunk("chunk", "file.txt", strings.NewReader("01"), 0, 3, 10).Close()
+	assert.ErrorContains(t, err, "smaller than 4 bytes")
+}
+
+func TestWriter_SetBoundary(t *testing.T) {
+	for boundary, want := range map[string]string{
+		"simple-boundary_1": "multipart/form-data; boundary=simple-boundary_1",
+		"with space":        `multipart/form-data; boundary="with space"`,
+		"a:b=c?d/e":         `multipart/form-data; boundary="a:b=c?d/e"`,
+		"(quoted),+.'":      `multipart/form-data; boundary="(quoted),+.'"`,
+	} {
+		buf := bytes.NewBuffer(nil)
+		w := formy.NewWriter(buf)
+		w.SetBoundary(boundary)
+
+		ct, err := w.WriteString("name", "alice").CloseAndType()
+		if assert.NoError(t, err, boundary) {
+			assert.Equal(t, want, ct)
+			assert.Equal(t, want, w.FormDataContentType(), "stable")
+
+			_, params, err := mime.ParseMediaType(ct)
+			if assert.NoError(t, err) {
+				assert.Equal(t, boundary, params["boundary"])
+				assert.Len(t, readParts(t, buf, params["boundary"]), 1)
+			}
+		}
+	}
+
+	w := formy.NewWriter(io.Discard)
+	w.SetSubtype("related")
+	w.SetBoundary("with space")
+	assert.Equal(t, `multipart/related; boundary="with space"`, w.FormDataContentType())
+
+	w = formy.NewWriter(io.Discard)
+	w.SetBoundary("invalid;")
+	assert.Error(t, w.Close())
+
+	w = formy.NewWriter(io.Discard)
+	w.WriteString("name", "alice").SetBoundary("late")
+	assert.Error(t, w.Close())
+}
+
+func TestWriter_WriteObject(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+		Zip  string `json:"zip"`
+	}
+	type profile struct {
+		Name    string   `json:"name"`
+		Tags    []string `json:"tags"`
+		Address address  `json:"address"`
+	}
+
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	want := profile{Name: "alice", Tags: []string{"a", "b"}, Address: address{City: "Paris", Zip: "75001"}}
+	err := w.WriteString("id", "42").WriteObject("profile", want).Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 2) {
+			assert.Equal(t, "application/json; charset=utf-8", parts[1].header.Get("Content-Type"))
+
+			var got profile
+			assert.NoError(t, json.Unmarshal([]byte(parts[1].body), &got))
+			assert.Equal(t, want, got)
+		}
+	}
+}
+
+func TestWriter_WriteImage(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	jpeg := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+	w.SetImageOnly(true)
+
+	err := w.WriteImage("png", png).
+		WriteImage("jpeg", jpeg).
+		Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 2) {
+			assert.Equal(t, "image.png", parts[0].filename)
+			assert.Equal(t, "image/png", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, string(png), parts[0].body)
+			assert.Equal(t, "image.jpg", parts[1].filename)
+			assert.Equal(t, "image/jpeg", parts[1].header.Get("Content-Type"))
+		}
+	}
+
+	w = formy.NewWriter(io.Discard)
+	w.SetImageOnly(true)
+	err = w.WriteImage("doc", []byte("%PDF-1.4")).Close()
+	assert.EqualError(t, err, "expected an image, got application/pdf")
+	assert.Zero(t, w.PartCount())
+
+	buf.Reset()
+	w = formy.NewWriter(buf)
+	err = w.WriteImage("doc", []byte("%PDF-1.4")).Close()
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "image.pdf", parts[0].filename)
+		}
+	}
+
+	buf.Reset()
+	w = formy.NewWriter(buf)
+	var peeked int
+	w.SetDetectLimit(4)
+	w.SetDetector(func(peek []byte, filename string) string {
+		peeked = len(peek)
+		return "image/webp"
+	})
+	err = w.WriteImage("webp", png).Close()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 4, peeked)
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "image.webp", parts[0].filename)
+			assert.Equal(t, "image/webp", parts[0].header.Get("Content-Type"))
+			assert.Equal(t, string(png), parts[0].body)
+		}
+	}
+}
+
+func TestWriter_DecodeFilenames(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+	w.DecodeFilenames(true)
+
+	err := w.WriteFile("file", "file%20name.txt", strings.NewReader("TEST")).
+		WriteFile("invalid", "100%.txt", strings.NewReader("TEST")).
+		WriteJSONFile("json", "data%2Bmeta.json", map[string]int{"a": 1}).
+		Close()
+
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 3) {
+			assert.Equal(t, `form-data; name="file"; filename="file name.txt"`, parts[0].header.Get("Content-Disposition"))
+			assert.Equal(t, "file name.txt", parts[0].filename)
+			assert.Equal(t, "100%.txt", parts[1].filename)
+			assert.Equal(t, "data+meta.json", parts[2].filename)
+		}
+	}
+
+	buf.Reset()
+	w = formy.NewWriter(buf)
+	err = w.WriteFile("file", "file%20name.txt", strings.NewReader("TEST")).Close()
+	if assert.NoError(t, err) {
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "file%20name.txt", parts[0].filename)
+		}
+	}
+}
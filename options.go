@@ -0,0 +1,68 @@
+package formy
+
+// Option configures a [Writer] created with [NewWriterWith]
+type Option func(w *Writer)
+
+// WithDetectContentType turns on/off content type detection, see [Writer.DetectContentType]
+func WithDetectContentType(b bool) Option {
+	return func(w *Writer) {
+		w.DetectContentType(b)
+	}
+}
+
+// WithBoundary sets the boundary, see [Writer.SetBoundary].
+// If the boundary is invalid, the error is recorded and returned by [Writer.Close]
+func WithBoundary(boundary string) Option {
+	return func(w *Writer) {
+		w.SetBoundary(boundary)
+	}
+}
+
+// WithMaxFileSize sets the maximum size of a single file, see [Writer.SetMaxFileSize]
+func WithMaxFileSize(n int64) Option {
+	return func(w *Writer) {
+		w.SetMaxFileSize(n)
+	}
+}
+
+// WithMaxTotalSize sets the maximum size of the whole body, see [Writer.SetMaxTotalSize]
+func WithMaxTotalSize(n int64) Option {
+	return func(w *Writer) {
+		w.SetMaxTotalSize(n)
+	}
+}
+
+// WithMaxParts sets the maximum number of parts, see [Writer.SetMaxParts]
+func WithMaxParts(n int) Option {
+	return func(w *Writer) {
+		w.SetMaxParts(n)
+	}
+}
+
+// WithCollectAllErrors turns on/off collecting of all errors, see [Writer.CollectAllErrors]
+func WithCollectAllErrors(b bool) Option {
+	return func(w *Writer) {
+		w.CollectAllErrors(b)
+	}
+}
+
+// WithRejectZeroTime turns on/off rejecting of the zero time, see [Writer.RejectZeroTime]
+func WithRejectZeroTime(b bool) Option {
+	return func(w *Writer) {
+		w.RejectZeroTime(b)
+	}
+}
+
+// WithMustMode turns on/off must mode, see [Writer.MustMode]
+func WithMustMode(b bool) Option {
+	return func(w *Writer) {
+		w.MustMode(b)
+	}
+}
+
+// WithTrimJSONNewline turns on/off trimming of the trailing newline of JSON parts, see [Writer.TrimJSONNewline]
+func WithTrimJSONNewline(b bool) Option {
+	return func(w *Writer) {
+		w.TrimJSONNewline(b)
+	}
+}
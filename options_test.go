@@ -0,0 +1,42 @@
+package formy_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bigelle/formy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWriterWith(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriterWith(buf,
+		formy.WithDetectContentType(false),
+		formy.WithBoundary("custom-boundary"),
+	)
+
+	err := w.WriteFile("file", "file.txt", strings.NewReader("TEST")).Close()
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, "custom-boundary", w.Boundary())
+		parts := readParts(t, buf, w.Boundary())
+		if assert.Len(t, parts, 1) {
+			assert.Equal(t, "application/octet-stream", parts[0].header.Get("Content-Type"))
+		}
+	}
+
+	w = formy.NewWriterWith(io.Discard,
+		formy.WithMaxFileSize(1024),
+		formy.WithCollectAllErrors(true),
+	)
+	err = w.WriteFile("big", "big.bin", &zeroReader{n: 2048}).
+		WriteInt("", 42).
+		Close()
+	assert.ErrorIs(t, err, formy.ErrFileTooLarge)
+	assert.Len(t, w.Errors(), 2)
+
+	err = formy.NewWriterWith(io.Discard, formy.WithBoundary("bad boundary!")).Close()
+	assert.Error(t, err)
+}
@@ -0,0 +1,41 @@
+package formy
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBufferSize is the capacity of the biggest buffer put back into the pool,
+// so a few huge bodies don't keep their memory alive forever
+const maxPooledBufferSize = 1 << 20
+
+var (
+	writerPool = sync.Pool{New: func() any { return new(Writer) }}
+	bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+)
+
+// AcquireWriter returns a writer with the default settings writing into the returned empty buffer,
+// both taken from a pool, to save allocations when building many small bodies.
+// They must be returned with [ReleaseWriter] once the body is sent
+func AcquireWriter() (*Writer, *bytes.Buffer) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	w := writerPool.Get().(*Writer)
+	w.reset(buf)
+	return w, buf
+}
+
+// ReleaseWriter puts w and buf taken from [AcquireWriter] back into the pool.
+// Neither of them, nor anything returned by them (like [bytes.Buffer.Bytes]),
+// can be used after the release, since they will be reused by other callers.
+// Nil arguments are ignored
+func ReleaseWriter(w *Writer, buf *bytes.Buffer) {
+	if w != nil {
+		w.reset(nil)
+		writerPool.Put(w)
+	}
+	if buf != nil && buf.Cap() <= maxPooledBufferSize {
+		buf.Reset()
+		bufferPool.Put(buf)
+	}
+}
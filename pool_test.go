@@ -0,0 +1,90 @@
+package formy_test
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bigelle/formy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireWriter(t *testing.T) {
+	w, buf := formy.AcquireWriter()
+	w.SetStrictFieldNames(true)
+	w.WriteString("name", "alice").WriteString("name", "bob")
+	assert.Error(t, w.Close())
+	formy.ReleaseWriter(w, buf)
+
+	// the state of the released writer doesn't leak into the next one
+	for range 10 {
+		w, buf := formy.AcquireWriter()
+		assert.Zero(t, buf.Len())
+		assert.Zero(t, w.PartCount())
+		assert.NoError(t, w.Err())
+
+		err := w.WriteString("name", "alice").WriteString("name", "bob").Close()
+		if assert.NoError(t, err) {
+			assert.Len(t, readParts(t, buf, w.Boundary()), 2)
+		}
+		formy.ReleaseWriter(w, buf)
+	}
+}
+
+func TestAcquireWriter_Concurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				w, buf := formy.AcquireWriter()
+				value := strconv.Itoa(i) + "-" + strconv.Itoa(j)
+				err := w.WriteString("value", value).
+					WriteFile("file", "file.txt", strings.NewReader(value)).
+					Close()
+				if assert.NoError(t, err) {
+					parts := readParts(t, bytes.NewReader(buf.Bytes()), w.Boundary())
+					if assert.Len(t, parts, 2) {
+						assert.Equal(t, value, parts[0].body)
+						assert.Equal(t, value, parts[1].body)
+					}
+				}
+				formy.ReleaseWriter(w, buf)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkAcquireWriter(b *testing.B) {
+	build := func(w *formy.Writer) error {
+		return w.WriteString("name", "alice").
+			WriteInt("age", 30).
+			WriteFile("file", "file.txt", strings.NewReader("TEST")).
+			Close()
+	}
+
+	b.Run("pool", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			w, buf := formy.AcquireWriter()
+			if err := build(w); err != nil {
+				b.Fatal(err)
+			}
+			formy.ReleaseWriter(w, buf)
+		}
+	})
+
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buf := new(bytes.Buffer)
+			if err := build(formy.NewWriter(buf)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
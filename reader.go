@@ -0,0 +1,217 @@
+package formy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+)
+
+// Reader is a wrapper around [multipart.Reader] with typed getters for the form fields.
+// Like [Writer], it records the first error occurred and makes the following calls no-ops,
+// so it can be checked once with [Reader.Err]
+type Reader struct {
+	mr       *multipart.Reader
+	parts    []readPart
+	parsed   bool
+	maxSize  int64
+	firstErr error
+}
+
+type readPart struct {
+	name     string
+	filename string
+	header   textproto.MIMEHeader
+	data     []byte
+}
+
+// NewReader is a wrapper around [multipart.NewReader].
+// The parts are read into memory all at once, on the first call of any getter,
+// so the untrusted input should be limited with [Reader.SetMaxSize]
+func NewReader(r io.Reader, boundary string) *Reader {
+	return &Reader{
+		mr: multipart.NewReader(r, boundary),
+	}
+}
+
+// SetMaxSize sets the maximum total size of the parts content in bytes, since all of it is read into memory,
+// e.g. when reading untrusted input. Exceeding it records an error wrapping [ErrBodyTooLarge].
+// Zero means unlimited, which is the default. It must be set before the first call of any getter
+func (r *Reader) SetMaxSize(n int64) {
+	r.maxSize = n
+}
+
+// Has reports whether the form has a part with the given name
+func (r *Reader) Has(name string) bool {
+	_, ok := r.lookup(name)
+	return ok
+}
+
+// String returns the value of the first part with the given name
+func (r *Reader) String(name string) string {
+	if p, ok := r.get(name); ok {
+		return string(p.data)
+	}
+	return ""
+}
+
+// Strings returns the values of all parts with the given name, in order.
+// Unlike other getters, it doesn't record an error if there are none
+func (r *Reader) Strings(name string) []string {
+	var vals []string
+	if r.parse() {
+		for _, p := range r.parts {
+			if p.name == name {
+				vals = append(vals, string(p.data))
+			}
+		}
+	}
+	return vals
+}
+
+// Int returns the value of the first part with the given name parsed with [strconv.Atoi]
+func (r *Reader) Int(name string) int {
+	if p, ok := r.get(name); ok {
+		i, err := strconv.Atoi(string(p.data))
+		if err != nil {
+			r.setErr(fmt.Errorf("field %s: %w", name, err))
+		}
+		return i
+	}
+	return 0
+}
+
+// Int64 returns the value of the first part with the given name parsed with [strconv.ParseInt]
+func (r *Reader) Int64(name string) int64 {
+	if p, ok := r.get(name); ok {
+		i, err := strconv.ParseInt(string(p.data), 10, 64)
+		if err != nil {
+			r.setErr(fmt.Errorf("field %s: %w", name, err))
+		}
+		return i
+	}
+	return 0
+}
+
+// Float64 returns the value of the first part with the given name parsed with [strconv.ParseFloat]
+func (r *Reader) Float64(name string) float64 {
+	if p, ok := r.get(name); ok {
+		f, err := strconv.ParseFloat(string(p.data), 64)
+		if err != nil {
+			r.setErr(fmt.Errorf("field %s: %w", name, err))
+		}
+		return f
+	}
+	return 0
+}
+
+// Bool returns the value of the first part with the given name parsed with [strconv.ParseBool]
+func (r *Reader) Bool(name string) bool {
+	if p, ok := r.get(name); ok {
+		b, err := strconv.ParseBool(string(p.data))
+		if err != nil {
+			r.setErr(fmt.Errorf("field %s: %w", name, err))
+		}
+		return b
+	}
+	return false
+}
+
+// JSON decodes the value of the first part with the given name into v
+func (r *Reader) JSON(name string, v any) *Reader {
+	if p, ok := r.get(name); ok {
+		if err := json.Unmarshal(p.data, v); err != nil {
+			r.setErr(fmt.Errorf("field %s: %w", name, err))
+		}
+	}
+	return r
+}
+
+// File returns the content, the file name and the content type of the first part with the given name
+func (r *Reader) File(name string) (file io.Reader, filename, contentType string) {
+	if p, ok := r.get(name); ok {
+		return bytes.NewReader(p.data), p.filename, p.header.Get("Content-Type")
+	}
+	return nil, "", ""
+}
+
+// Err returns the first error occurred while reading or parsing any fields
+func (r *Reader) Err() error {
+	return r.firstErr
+}
+
+// get returns the first part with the given name, recording an error if there's none
+func (r *Reader) get(name string) (readPart, bool) {
+	if r.firstErr != nil {
+		return readPart{}, false
+	}
+	p, ok := r.lookup(name)
+	if !ok && r.firstErr == nil {
+		r.setErr(fmt.Errorf("missing field %s", name))
+	}
+	return p, ok
+}
+
+// lookup returns the first part with the given name
+func (r *Reader) lookup(name string) (readPart, bool) {
+	if r.parse() {
+		for _, p := range r.parts {
+			if p.name == name {
+				return p, true
+			}
+		}
+	}
+	return readPart{}, false
+}
+
+// parse reads all parts, if they were not read yet, and reports whether it succeeded
+func (r *Reader) parse() bool {
+	if r.parsed {
+		return r.firstErr == nil
+	}
+	r.parsed = true
+
+	var size int64
+	for {
+		part, err := r.mr.NextPart()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			r.setErr(err)
+			return false
+		}
+
+		var data []byte
+		if r.maxSize > 0 {
+			// reading one byte more than allowed to find out if there's anything left
+			data, err = io.ReadAll(io.LimitReader(part, r.maxSize-size+1))
+			size += int64(len(data))
+			if err == nil && size > r.maxSize {
+				err = fmt.Errorf("%w: parts exceed %d bytes", ErrBodyTooLarge, r.maxSize)
+			}
+		} else {
+			data, err = io.ReadAll(part)
+		}
+		if err != nil {
+			r.setErr(err)
+			return false
+		}
+		r.parts = append(r.parts, readPart{
+			name:     part.FormName(),
+			filename: part.FileName(),
+			header:   part.Header,
+			data:     data,
+		})
+	}
+}
+
+// setErr records err, if no error was recorded yet
+func (r *Reader) setErr(err error) {
+	if r.firstErr == nil {
+		r.firstErr = err
+	}
+}
@@ -0,0 +1,120 @@
+package formy_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bigelle/formy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReader(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteString("string", "text").
+		WriteInt("int", 42).
+		WriteInt64("int64", 1<<40).
+		WriteFloat64("float64", 0.42).
+		WriteBool("bool", true).
+		WriteJSON("json", map[string]int{"a": 1}).
+		WriteFile("file", "file.txt", strings.NewReader("TEST")).
+		WriteString("tags", "a").
+		WriteString("tags", "b").
+		Close()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r := formy.NewReader(buf, w.Boundary())
+
+	assert.True(t, r.Has("string"))
+	assert.False(t, r.Has("missing"))
+	assert.Equal(t, "text", r.String("string"))
+	assert.Equal(t, 42, r.Int("int"))
+	assert.Equal(t, int64(1<<40), r.Int64("int64"))
+	assert.Equal(t, 0.42, r.Float64("float64"))
+	assert.True(t, r.Bool("bool"))
+	assert.Equal(t, []string{"a", "b"}, r.Strings("tags"))
+
+	var m map[string]int
+	assert.NoError(t, r.JSON("json", &m).Err())
+	assert.Equal(t, map[string]int{"a": 1}, m)
+
+	file, filename, ct := r.File("file")
+	if assert.NotNil(t, file) {
+		b, err := io.ReadAll(file)
+		assert.NoError(t, err)
+		assert.Equal(t, "TEST", string(b))
+	}
+	assert.Equal(t, "file.txt", filename)
+	assert.Equal(t, "text/plain; charset=utf-8", ct)
+
+	assert.NoError(t, r.Err())
+}
+
+func TestReader_Errors(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteString("string", "text").Close()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	body := buf.String()
+
+	r := formy.NewReader(strings.NewReader(body), w.Boundary())
+	assert.Equal(t, 0, r.Int("string"))
+	assert.ErrorContains(t, r.Err(), "field string")
+
+	r = formy.NewReader(strings.NewReader(body), w.Boundary())
+	r.String("missing")
+	assert.EqualError(t, r.Err(), "missing field missing")
+
+	r = formy.NewReader(strings.NewReader("garbage"), w.Boundary())
+	r.String("string")
+	assert.Error(t, r.Err())
+}
+
+func TestReader_WriteEmpty(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteEmpty("empty").Close()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r := formy.NewReader(buf, w.Boundary())
+	assert.True(t, r.Has("empty"))
+	assert.Equal(t, "", r.String("empty"))
+	assert.NoError(t, r.Err())
+
+	assert.Error(t, formy.NewWriter(io.Discard).WriteEmpty("").Err())
+}
+
+func TestReader_SetMaxSize(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	err := w.WriteString("a", strings.Repeat("a", 600)).
+		WriteString("b", strings.Repeat("b", 600)).
+		Close()
+	if !assert.NoError(t, err) {
+		return
+	}
+	body := buf.String()
+
+	r := formy.NewReader(strings.NewReader(body), w.Boundary())
+	r.SetMaxSize(1200)
+	assert.Len(t, r.String("b"), 600)
+	assert.NoError(t, r.Err())
+
+	r = formy.NewReader(strings.NewReader(body), w.Boundary())
+	r.SetMaxSize(1000)
+	assert.False(t, r.Has("a"))
+	assert.ErrorIs(t, r.Err(), formy.ErrBodyTooLarge)
+}
@@ -0,0 +1,212 @@
+package formy
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// WriteStruct creates a part for each exported field of v, which must be a struct or a pointer to it.
+// The field name is taken from the "form" tag, or from the name of the Go field if there's none.
+// The "omitempty" tag option skips the field if it has a zero value, and a "-" tag skips it entirely.
+//
+// Values implementing [encoding.TextMarshaler] (like [time.Time]) are written with [Writer.WriteTextMarshaler],
+// byte slices with [Writer.WriteBytes], other slices and arrays produce a part per element,
+// and nil pointers are skipped. Nested structs are flattened using dotted names like "parent.child",
+// while embedded structs (or pointers to them) are flattened as if their fields belonged to the outer struct.
+// Fields of unsupported kinds (channels, functions, maps, etc.) and cyclic pointers record an error
+func (w *Writer) WriteStruct(v any) *Writer {
+	return w.writeStruct(v, "form")
+}
+
+// WriteStructJSONTags works like [Writer.WriteStruct], but takes the field names and options
+// from the "json" tag instead, so the structs already annotated for JSON don't need "form" tags.
+// The "form" tag is ignored entirely, even if the field has both
+func (w *Writer) WriteStructJSONTags(v any) *Writer {
+	return w.writeStruct(v, "json")
+}
+
+// writeStruct is [Writer.WriteStruct] taking field names from the tagKey tag
+func (w *Writer) writeStruct(v any, tagKey string) *Writer {
+	if !w.failed() {
+		rv := reflect.ValueOf(v)
+		for rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				w.setErr("", fmt.Errorf("nil struct pointer"))
+				return w
+			}
+			rv = rv.Elem()
+		}
+		if rv.Kind() != reflect.Struct {
+			w.setErr("", fmt.Errorf("expected a struct, got %T", v))
+			return w
+		}
+		w.writeStructFields(rv, "", tagKey, make(map[visit]bool))
+	}
+	return w
+}
+
+// visit is a pointer being followed while writing a struct, used to detect cycles
+type visit struct {
+	typ reflect.Type
+	ptr uintptr
+}
+
+func (w *Writer) writeStructFields(rv reflect.Value, prefix, tagKey string, seen map[visit]bool) {
+	rt := rv.Type()
+	for i := range rt.NumField() {
+		if w.failed() {
+			return
+		}
+
+		sf := rt.Field(i)
+		name, opts, _ := strings.Cut(sf.Tag.Get(tagKey), ",")
+		if name == "-" {
+			continue
+		}
+
+		fv := rv.Field(i)
+		// embedded structs are flattened even if their type is unexported, like in encoding/json,
+		// but the pointers to unexported ones are skipped, since their fields can't be reached
+		if name == "" && sf.Anonymous {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if sf.Type.Kind() == reflect.Pointer && !sf.IsExported() {
+					continue
+				}
+				w.writeEmbedded(prefix, fv, tagKey, seen)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		if slices.Contains(strings.Split(opts, ","), "omitempty") && isEmpty(fv, tagKey) {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		w.writeValue(prefix+name, fv, tagKey, seen)
+	}
+}
+
+// writeEmbedded writes the fields of the embedded struct v, which may be a pointer, with the outer prefix
+func (w *Writer) writeEmbedded(prefix string, v reflect.Value, tagKey string, seen map[visit]bool) {
+	if v.Kind() != reflect.Pointer {
+		w.writeStructFields(v, prefix, tagKey, seen)
+		return
+	}
+	if v.IsNil() {
+		return
+	}
+	if leave, ok := w.enter(prefix, v, seen); ok {
+		defer leave()
+		w.writeStructFields(v.Elem(), prefix, tagKey, seen)
+	}
+}
+
+// enter marks the pointer v as being followed, recording an error if it already is, which means a cycle.
+// The returned function must be called once v is written
+func (w *Writer) enter(name string, v reflect.Value, seen map[visit]bool) (leave func(), ok bool) {
+	k := visit{typ: v.Type(), ptr: v.Pointer()}
+	if seen[k] {
+		w.setErr(name, fmt.Errorf("cyclic pointer in field %s", strings.TrimSuffix(name, ".")))
+		return nil, false
+	}
+	seen[k] = true
+	return func() { delete(seen, k) }, true
+}
+
+func (w *Writer) writeValue(name string, v reflect.Value, tagKey string, seen map[visit]bool) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		if v.Kind() == reflect.Pointer {
+			leave, ok := w.enter(name, v, seen)
+			if !ok {
+				return
+			}
+			defer leave()
+		}
+		v = v.Elem()
+	}
+
+	if m, ok := textMarshaler(v); ok {
+		w.WriteTextMarshaler(name, m)
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		w.WriteString(name, v.String())
+	case reflect.Bool:
+		w.WriteBool(name, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.WriteInt64(name, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		w.WriteUint64(name, v.Uint())
+	case reflect.Float32:
+		w.WriteFloat32(name, float32(v.Float()))
+	case reflect.Float64:
+		w.WriteFloat64(name, v.Float())
+	case reflect.Struct:
+		w.writeStructFields(v, name+".", tagKey, seen)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			w.WriteBytes(name, v.Bytes())
+			return
+		}
+		for i := range v.Len() {
+			if w.failed() {
+				return
+			}
+			w.writeValue(name, v.Index(i), tagKey, seen)
+		}
+	default:
+		w.setErr(name, fmt.Errorf("unsupported kind %s of field %s", v.Kind(), name))
+	}
+}
+
+// isEmpty reports whether v is empty for the "omitempty" option. With the "json" tag key,
+// the rules of [encoding/json] apply: empty maps, slices, arrays and strings are empty even if not nil,
+// while structs never are. Otherwise, v is empty if it's the zero value
+func isEmpty(v reflect.Value, tagKey string) bool {
+	if tagKey != "json" {
+		return v.IsZero()
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+// textMarshaler returns v as [encoding.TextMarshaler] if either v or its address implements it
+func textMarshaler(v reflect.Value) (encoding.TextMarshaler, bool) {
+	if !v.CanInterface() {
+		return nil, false
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		return m, true
+	}
+	if v.CanAddr() {
+		if m, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
+			return m, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,184 @@
+package formy_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bigelle/formy"
+	"github.com/stretchr/testify/assert"
+)
+
+type Base struct {
+	ID int64 `form:"id"`
+}
+
+type address struct {
+	City string `form:"city"`
+	Zip  string `form:"zip,omitempty"`
+}
+
+type user struct {
+	Base
+	Name     string    `form:"name"`
+	Nickname string    `form:"nickname,omitempty"`
+	Age      uint8     `form:"age"`
+	Admin    bool      `form:"admin"`
+	Score    float64   `form:"score"`
+	Tags     []string  `form:"tags"`
+	Address  address   `form:"address"`
+	Manager  *user     `form:"manager"`
+	Created  time.Time `form:"created"`
+	Password string    `form:"-"`
+	Untagged string
+	internal string
+}
+
+func TestWriter_WriteStruct(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	u := user{
+		Base:     Base{ID: 7},
+		Name:     "alice",
+		Age:      30,
+		Admin:    true,
+		Score:    9.5,
+		Tags:     []string{"a", "b"},
+		Address:  address{City: "Paris"},
+		Created:  time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+		Password: "secret",
+		Untagged: "untagged",
+		internal: "internal",
+	}
+	err := w.WriteStruct(&u).Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.body)
+		}
+		assert.Equal(t, []string{
+			"id=7",
+			"name=alice",
+			"age=30",
+			"admin=true",
+			"score=9.5",
+			"tags=a",
+			"tags=b",
+			"address.city=Paris",
+			"created=2024-03-01T00:00:00Z",
+			"Untagged=untagged",
+		}, got)
+	}
+}
+
+func TestWriter_WriteStructUnsupported(t *testing.T) {
+	v := struct {
+		Ch chan int `form:"ch"`
+	}{Ch: make(chan int)}
+
+	err := formy.NewWriter(io.Discard).WriteStruct(v).Close()
+	assert.ErrorContains(t, err, "ch")
+
+	err = formy.NewWriter(io.Discard).WriteStruct(42).Close()
+	assert.Error(t, err)
+}
+
+func TestWriter_WriteStructJSONTags(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	v := struct {
+		Name     string   `json:"name" form:"ignored"`
+		Nickname string   `json:"nickname,omitempty"`
+		Age      int      `json:"age,omitempty"`
+		Tags     []string `json:"tags"`
+		Address  address  `json:"address"`
+		Password string   `json:"-"`
+		Untagged bool
+		Empty    map[string]int `json:"empty,omitempty"`
+		Arr      [0]int         `json:"arr,omitempty"`
+		Created  time.Time      `json:"created,omitempty"`
+	}{
+		Name:     "alice",
+		Tags:     []string{"a", "b"},
+		Address:  address{City: "Paris"},
+		Password: "secret",
+		Untagged: true,
+		Empty:    map[string]int{},
+	}
+	err := w.WriteStructJSONTags(v).Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.body)
+		}
+		assert.Equal(t, []string{
+			"name=alice",
+			"tags=a",
+			"tags=b",
+			"address.City=Paris",
+			"address.Zip=",
+			"Untagged=true",
+			"created=0001-01-01T00:00:00Z",
+		}, got)
+	}
+}
+
+type embedded struct {
+	ID int `form:"id"`
+}
+
+type Embedded struct {
+	Age int `form:"age"`
+}
+
+func TestWriter_WriteStructEmbedded(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := formy.NewWriter(buf)
+
+	v := struct {
+		embedded
+		*Embedded
+		Name string `form:"name"`
+	}{
+		embedded: embedded{ID: 7},
+		Embedded: &Embedded{Age: 30},
+		Name:     "alice",
+	}
+	err := w.WriteStruct(v).Close()
+
+	if assert.NoError(t, err) {
+		var got []string
+		for _, p := range readParts(t, buf, w.Boundary()) {
+			got = append(got, p.name+"="+p.body)
+		}
+		assert.Equal(t, []string{"id=7", "age=30", "name=alice"}, got)
+	}
+
+	v.Embedded = nil
+	buf.Reset()
+	w = formy.NewWriter(buf)
+	if assert.NoError(t, w.WriteStruct(v).Close()) {
+		assert.Len(t, readParts(t, buf, w.Boundary()), 2)
+	}
+}
+
+func TestWriter_WriteStructCycle(t *testing.T) {
+	u := user{Name: "alice"}
+	u.Manager = &u
+
+	err := formy.NewWriter(io.Discard).WriteStruct(&u).Close()
+	assert.ErrorContains(t, err, "cyclic pointer")
+
+	// the same pointer in sibling fields is not a cycle
+	m := &user{Name: "bob"}
+	v := struct {
+		A *user `form:"a"`
+		B *user `form:"b"`
+	}{A: m, B: m}
+	assert.NoError(t, formy.NewWriter(io.Discard).WriteStruct(v).Close())
+}